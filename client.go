@@ -3,6 +3,11 @@ package ssh
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/crypto/ssh"
 )
 
 var ErrConfigNotFound = errors.New("config not found")
@@ -12,3 +17,168 @@ type ConfigCallback func(ctx context.Context, network, address string) (*Config,
 type Client struct {
 	ConfigCallback ConfigCallback
 }
+
+// Config parses the destination and returns the config for it. The
+// callback is called with the host and port of the destination, while
+// the user given in the destination overrides the configured one, unless
+// the callback applied the destination itself, see ContextDestination.
+func (c *Client) Config(ctx context.Context, network, destination string) (*Config, error) {
+	d, err := ParseDestination(destination)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.Path != "" {
+		return nil, fmt.Errorf("unexpected path in destination %q", destination)
+	}
+
+	dv := &destinationValue{d: d}
+
+	cfg, err := c.ConfigCallback(context.WithValue(ctx, destinationKey, dv), network, d.Address())
+	if err != nil {
+		return nil, err
+	}
+
+	if d.User != "" && !dv.taken {
+		cfg.User = d.User
+	}
+
+	return cfg, nil
+}
+
+type contextKey struct{ string }
+
+var destinationKey = contextKey{"destination"}
+
+type destinationValue struct {
+	d     *Destination
+	taken bool
+}
+
+// ContextDestination returns the destination the config is requested for
+// by Client.Config, or nil if there is none. A callback that takes it is
+// responsible for applying its user, for example with the precedence of
+// the command line options over it, and the Client leaves the user as
+// returned by the callback.
+func ContextDestination(ctx context.Context) *Destination {
+	if dv, ok := ctx.Value(destinationKey).(*destinationValue); ok && dv.d != nil {
+		dv.taken = true
+		return dv.d
+	}
+	return nil
+}
+
+// WithDestination returns a context carrying the destination the config
+// is requested for. A nil destination hides the one carried by ctx, which
+// is needed by callbacks that share configs between destinations.
+func WithDestination(ctx context.Context, d *Destination) context.Context {
+	return context.WithValue(ctx, destinationKey, &destinationValue{d: d})
+}
+
+// DialContext connects to the destination using the config returned by
+// the callback with the options applied on top of it. If the config has
+// jump hosts, the connection is made through them, each one connected
+// with its own config returned by the callback.
+func (c *Client) DialContext(ctx context.Context, network, destination string, opts ...Option) (*Conn, error) {
+	cfg, err := c.Config(ctx, network, destination)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg = cfg.Clone().With(opts...)
+
+	var via *Conn
+
+	for _, jump := range cfg.Jump {
+		jcfg, err := c.Config(ctx, "tcp", jump)
+		if err != nil {
+			closeConn(via)
+			return nil, fmt.Errorf("failed to configure jump host %q: %w", jump, err)
+		}
+
+		if via, err = dial(ctx, via, jcfg); err != nil {
+			return nil, fmt.Errorf("failed to connect to jump host %q: %w", jump, err)
+		}
+	}
+
+	conn, err := dial(ctx, via, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %q: %w", destination, err)
+	}
+
+	return conn, nil
+}
+
+// dial connects to the address of the config, through the given connection
+// if it is not nil, in which case it is closed on failure.
+func dial(ctx context.Context, via *Conn, cfg *Config) (*Conn, error) {
+	network := cfg.Network
+	if network == "" {
+		network = "tcp"
+	}
+
+	var (
+		nc  net.Conn
+		err error
+	)
+
+	if via != nil {
+		nc, err = via.Dial(network, cfg.Address)
+	} else {
+		d := &net.Dialer{Timeout: cfg.Timeout}
+		if !cfg.KeepAlive {
+			d.KeepAlive = -1
+		}
+		nc, err = d.DialContext(ctx, network, cfg.Address)
+	}
+
+	if err != nil {
+		closeConn(via)
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		nc.SetDeadline(deadline)
+	}
+
+	// Abort the handshake when the context is done.
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			nc.Close()
+		case <-done:
+		}
+	}()
+
+	sc, chans, reqs, err := ssh.NewClientConn(nc, cfg.Address, &cfg.ClientConfig)
+	close(done)
+
+	if err != nil {
+		nc.Close()
+		closeConn(via)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	nc.SetDeadline(time.Time{})
+
+	conn := &Conn{
+		Client: ssh.NewClient(sc, chans, reqs),
+		via:    via,
+	}
+
+	if cfg.ServerAlive.Interval > 0 {
+		go conn.heartbeat(cfg.ServerAlive)
+	}
+
+	return conn, nil
+}
+
+func closeConn(c *Conn) {
+	if c != nil {
+		c.Close()
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/glaucusio/ssh/sshfile"
+	"github.com/glaucusio/ssh/sshos"
+
+	"github.com/spf13/cobra"
+)
+
+func newConfigCommand(a *app) *cobra.Command {
+	m := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect ssh_config files",
+	}
+
+	m.AddCommand(&cobra.Command{
+		Use:   "explain <host>",
+		Short: "Print effective configuration for a host annotated with origin of each value",
+		Args:  cobra.ExactArgs(1),
+		RunE:  a.explain,
+	})
+
+	m.AddCommand(&cobra.Command{
+		Use:   "lint [file...]",
+		Short: "Check ssh_config files for problems",
+		Args:  cobra.ArbitraryArgs,
+		RunE:  a.lint,
+
+		SilenceUsage: true,
+	})
+
+	f := &formatter{app: a}
+
+	fmtCmd := &cobra.Command{
+		Use:   "fmt [file...]",
+		Short: "Format ssh_config files",
+		Args:  cobra.ArbitraryArgs,
+		RunE:  f.run,
+	}
+
+	fmtCmd.Flags().BoolVarP(&f.write, "write", "w", false, "write result to the file instead of stdout")
+	fmtCmd.Flags().BoolVar(&f.list, "list", false, "list files whose formatting differs")
+
+	m.AddCommand(fmtCmd)
+
+	e := &exporter{app: a}
+
+	exportCmd := &cobra.Command{
+		Use:   "export <host>",
+		Short: "Print effective configuration for a host as ssh_config or ssh options",
+		Args:  cobra.ExactArgs(1),
+		RunE:  e.run,
+	}
+
+	exportCmd.Flags().BoolVar(&e.args, "args", false, "print ssh command line options instead of ssh_config")
+
+	m.AddCommand(exportCmd)
+
+	return m
+}
+
+func (a *app) explain(cmd *cobra.Command, args []string) error {
+	cfgfile, err := a.Config()
+	if err != nil {
+		return err
+	}
+
+	cfg, _, err := a.lookup(cfgfile, args[0])
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+
+	for _, s := range cfg.Settings() {
+		fmt.Fprintf(w, "%s\t%s\t# %s\n", s.Keyword, s.Value, s.Origin)
+	}
+
+	return w.Flush()
+}
+
+func (a *app) lint(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		args = []string{a.UserConfig}
+	}
+
+	var errors, warnings int
+
+	for _, file := range args {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+
+		diags, err := sshfile.Lint(f, file)
+		f.Close()
+
+		if err != nil {
+			return fmt.Errorf("failed to lint %q: %w", file, err)
+		}
+
+		for _, d := range diags {
+			fmt.Println(d)
+
+			if d.Severity == sshfile.SeverityError {
+				errors++
+			} else {
+				warnings++
+			}
+		}
+	}
+
+	if errors != 0 || (a.Parser.Strict && warnings != 0) {
+		return fmt.Errorf("found %d error(s) and %d warning(s)", errors, warnings)
+	}
+
+	return nil
+}
+
+type formatter struct {
+	*app
+	write bool
+	list  bool
+}
+
+func (f *formatter) run(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		args = []string{f.UserConfig}
+	}
+
+	for _, file := range args {
+		p, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		formatted, err := sshfile.Format(bytes.NewReader(p))
+		if err != nil {
+			return fmt.Errorf("failed to format %q: %w", file, err)
+		}
+
+		if f.list && !bytes.Equal(p, formatted) {
+			fmt.Println(file)
+		}
+
+		if f.write {
+			if bytes.Equal(p, formatted) {
+				continue
+			}
+
+			if err := sshos.WriteFile(file, formatted); err != nil {
+				return err
+			}
+		}
+
+		if !f.list && !f.write {
+			os.Stdout.Write(formatted)
+		}
+	}
+
+	return nil
+}
+
+type exporter struct {
+	*app
+	args bool
+}
+
+func (e *exporter) run(cmd *cobra.Command, args []string) error {
+	cfgfile, err := e.Config()
+	if err != nil {
+		return err
+	}
+
+	cfg, host, err := e.effective(cfgfile, args[0])
+	if err != nil {
+		return err
+	}
+
+	if e.args {
+		quoted := make([]string, 0, len(cfg.Args()))
+		for _, arg := range cfg.Args() {
+			quoted = append(quoted, shellQuote(arg))
+		}
+		fmt.Println(strings.Join(quoted, " "))
+		return nil
+	}
+
+	_, err = cfg.File(host).WriteTo(os.Stdout)
+	return err
+}
+
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !strings.ContainsRune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=+/.,:@%", r)
+	}) == -1 {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
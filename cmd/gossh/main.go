@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
 
+	"github.com/glaucusio/ssh/sshfile"
 	"github.com/glaucusio/ssh/sshos"
 	"github.com/glaucusio/ssh/sshtrace"
 
@@ -20,17 +22,57 @@ func die(v interface{}) {
 type app struct {
 	*sshos.Loader
 	verbose bool
+	print   bool
+	json    bool
+	port    int
+	login   string
+	jump    string
+}
+
+func warn(err error) {
+	fmt.Fprintln(os.Stderr, "warning:", err)
 }
 
 func (a *app) register(f *pflag.FlagSet) {
 	f.StringVarP(&a.UserConfig, "config", "F", a.UserConfig, "")
 	f.StringArrayVarP(&a.Identity, "identity", "i", a.Identity, "")
 	f.StringArrayVarP(&a.Options, "option", "o", a.Options, "")
+	f.StringVar(&a.Overlay, "project-config", a.Overlay, "")
 	f.BoolVarP(&a.verbose, "verbose", "v", false, "")
+	f.BoolVarP(&a.print, "print-config", "G", false, "")
+	f.BoolVar(&a.json, "json", false, "")
+	f.IntVarP(&a.port, "port", "p", 0, "")
+	f.StringVarP(&a.login, "login", "l", "", "")
+	f.StringVarP(&a.jump, "jump", "J", "", "")
+	f.BoolVar(&a.Parser.Strict, "strict", a.Parser.Strict, "")
+}
+
+func (a *app) init(cmd *cobra.Command, args []string) error {
+	var flags []string
+
+	if a.port != 0 {
+		flags = append(flags, "Port="+strconv.Itoa(a.port))
+	}
+	if a.login != "" {
+		flags = append(flags, "User="+a.login)
+	}
+	if a.jump != "" {
+		flags = append(flags, "ProxyJump="+a.jump)
+	}
+
+	// Like in ssh, the flags take precedence over the -o options, which
+	// are first-wins, so they go before them.
+	a.Options = append(flags, a.Options...)
+
+	return nil
 }
 
 func (a *app) run(cmd *cobra.Command, args []string) error {
-	c, err := sshos.NewClient()
+	if a.print {
+		return a.printConfig(args)
+	}
+
+	c, err := a.NewClient()
 	if err != nil {
 		return err
 	}
@@ -42,7 +84,7 @@ func (a *app) run(cmd *cobra.Command, args []string) error {
 	}
 
 	for _, arg := range args {
-		cfg, err := c.ConfigCallback(ctx, "tcp", arg)
+		cfg, err := c.Config(ctx, "tcp", arg)
 		if err != nil {
 			return err
 		}
@@ -57,8 +99,10 @@ func (a *app) run(cmd *cobra.Command, args []string) error {
 
 func main() {
 	app := &app{
-		Loader: sshos.DefaultLoader,
+		Loader: sshos.NewLoader(""),
 	}
+	app.Parser = &sshfile.Parser{Warn: warn}
+
 	cmd := newCommand(app)
 
 	if err := cmd.Execute(); err != nil {
@@ -72,8 +116,12 @@ func newCommand(a *app) *cobra.Command {
 		Short: "Command line interface to glaucusio/ssh",
 		Args:  cobra.ArbitraryArgs,
 		RunE:  a.run,
+
+		PersistentPreRunE: a.init,
 	}
 
+	m.AddCommand(newConfigCommand(a))
+
 	a.register(pflag.CommandLine)
 
 	return m
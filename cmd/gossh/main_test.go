@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/glaucusio/ssh/sshfile"
+	"github.com/glaucusio/ssh/sshos"
+
+	"github.com/spf13/pflag"
+)
+
+func TestPrintConfigFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gossh")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "config"), []byte("Host web\n\tUser admin\n"), 0600); err != nil {
+		t.Fatalf("WriteFile()=%s", err)
+	}
+
+	a := &app{Loader: sshos.NewLoader(dir)}
+	a.Parser = &sshfile.Parser{}
+	a.SystemConfig = filepath.Join(dir, "ssh_config")
+	a.Overlay = "none"
+
+	// newCommand registers the flags globally, once per process.
+	pflag.CommandLine = pflag.NewFlagSet(os.Args[0], pflag.ExitOnError)
+
+	cmd := newCommand(a)
+	cmd.SetArgs([]string{"-G", "-o", "Port=1", "-p", "2", "-o", "User=root", "-l", "deploy", "web"})
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe()=%s", err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+
+	err = cmd.Execute()
+
+	os.Stdout = stdout
+	w.Close()
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, r); err != nil {
+		t.Fatalf("Copy()=%s", err)
+	}
+
+	if err != nil {
+		t.Fatalf("Execute()=%s", err)
+	}
+
+	lines := strings.Split(buf.String(), "\n")
+
+	for _, want := range []string{"user deploy", "port 2"} {
+		if !contains(lines, want) {
+			t.Errorf("missing %q in:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestFormatWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gossh")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	target, link := filepath.Join(dir, "dotfiles_config"), filepath.Join(dir, "config")
+
+	if err := ioutil.WriteFile(target, []byte("Host web\nUser admin\n"), 0640); err != nil {
+		t.Fatalf("WriteFile()=%s", err)
+	}
+
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatalf("Symlink()=%s", err)
+	}
+
+	a := &app{Loader: sshos.NewLoader(dir)}
+	a.Parser = &sshfile.Parser{}
+
+	// newCommand registers the flags globally, once per process.
+	pflag.CommandLine = pflag.NewFlagSet(os.Args[0], pflag.ExitOnError)
+
+	cmd := newCommand(a)
+	cmd.SetArgs([]string{"config", "fmt", "-w", link})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Execute()=%s", err)
+	}
+
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("config is no longer a symlink: %v", err)
+	}
+
+	fi, err := os.Stat(target)
+	if err != nil {
+		t.Fatalf("Stat()=%s", err)
+	}
+
+	if perm := fi.Mode().Perm(); perm != 0640 {
+		t.Fatalf("got %04o permissions, want 0640", perm)
+	}
+
+	p, err := ioutil.ReadFile(target)
+	if err != nil {
+		t.Fatalf("ReadFile()=%s", err)
+	}
+
+	if want := "Host web\n\tUser admin\n"; string(p) != want {
+		t.Fatalf("got %q, want %q", p, want)
+	}
+}
+
+func contains(lines []string, s string) bool {
+	for _, line := range lines {
+		if line == s {
+			return true
+		}
+	}
+	return false
+}
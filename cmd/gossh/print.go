@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+
+	"github.com/glaucusio/ssh"
+	"github.com/glaucusio/ssh/sshfile"
+)
+
+func (a *app) printConfig(args []string) error {
+	cfgfile, err := a.Config()
+	if err != nil {
+		return err
+	}
+
+	for _, host := range args {
+		cfg, _, err := a.effective(cfgfile, host)
+		if err != nil {
+			return err
+		}
+
+		if a.json {
+			if err := printJSON(cfg); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, s := range cfg.Dump() {
+			fmt.Println(s)
+		}
+	}
+
+	return nil
+}
+
+// lookup returns the config for the destination together with its host.
+func (a *app) lookup(cfgfile sshfile.Configs, destination string) (*sshfile.Config, string, error) {
+	d, err := ssh.ParseDestination(destination)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cfg, err := cfgfile.Lookup(processContext(), d.Host)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to lookup %q: %w", d.Host, err)
+	}
+
+	cfg.ApplyDestination(d)
+
+	return cfg, d.Host, nil
+}
+
+// effective returns fully evaluated config for the destination, in the
+// same way ssh -G evaluates it. The identity files given with -i are
+// the defaults of the loader, so they are listed only for the hosts
+// with none configured, like the client uses them.
+func (a *app) effective(cfgfile sshfile.Configs, destination string) (*sshfile.Config, string, error) {
+	cfg, host, err := a.lookup(cfgfile, destination)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if cfg, err = cfg.Expand(host); err != nil {
+		return nil, "", fmt.Errorf("failed to expand config for %q: %w", host, err)
+	}
+
+	if cfg.Hostname == "" {
+		cfg.Hostname = host
+	}
+
+	if cfg.Port == 0 {
+		cfg.Port = 22
+	}
+
+	if cfg.User == "" {
+		if u, err := user.Current(); err == nil {
+			cfg.User = u.Username
+		}
+	}
+
+	return cfg, host, nil
+}
+
+func printJSON(cfg *sshfile.Config) error {
+	cfg.Origins = nil
+
+	p, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	var m map[string]interface{}
+
+	if err := json.Unmarshal(p, &m); err != nil {
+		return err
+	}
+
+	delete(m, "host")
+	delete(m, "match")
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+
+	return enc.Encode(m)
+}
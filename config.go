@@ -23,6 +23,7 @@ type Config struct {
 	Address     string
 	KeepAlive   bool
 	ServerAlive Heartbeat
+	Jump        []string // destinations to connect through, in order
 }
 
 func (cfg *Config) With(opts ...Option) *Config {
@@ -32,6 +33,21 @@ func (cfg *Config) With(opts ...Option) *Config {
 	return cfg
 }
 
+// Clone returns a copy of the config, which can be modified, for example
+// by applying options, without affecting the original one.
+func (cfg *Config) Clone() *Config {
+	if cfg == nil {
+		return nil
+	}
+
+	cfgCopy := *cfg
+
+	cfgCopy.Auth = append([]ssh.AuthMethod(nil), cfg.Auth...)
+	cfgCopy.Jump = append([]string(nil), cfg.Jump...)
+
+	return &cfgCopy
+}
+
 func (cfg *Config) WithAuth(methods ...ssh.AuthMethod) *Config {
 	cfg.ClientConfig.Auth = append(cfg.ClientConfig.Auth, methods...)
 	return cfg
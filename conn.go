@@ -1,7 +1,86 @@
 package ssh
 
-import "golang.org/x/crypto/ssh"
+import (
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
 
 type Conn struct {
 	*ssh.Client
+
+	via *Conn // connection to the jump host this one was made through
+}
+
+// Close closes the connection together with the connections to the jump
+// hosts it was made through.
+func (c *Conn) Close() error {
+	err := c.Client.Close()
+
+	if c.via != nil {
+		if e := c.via.Close(); err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// heartbeat sends keepalive requests to the server and closes the connection
+// after the configured number of them is missed.
+func (c *Conn) heartbeat(hb Heartbeat) {
+	max := hb.MaxCount
+	if max <= 0 {
+		max = 3
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		c.Wait()
+		close(done)
+	}()
+
+	t := time.NewTicker(hb.Interval)
+	defer t.Stop()
+
+	for missed := 0; ; {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+
+		if !c.keepalive(hb.Interval) {
+			if missed++; missed >= max {
+				c.Client.Close()
+				return
+			}
+		} else {
+			missed = 0
+		}
+	}
+}
+
+// keepalive sends a keepalive request to the server and reports whether
+// it replied within the given timeout. A peer that went away without
+// closing the connection never replies, so the request is not waited
+// for past the timeout; it is unblocked once the connection is closed.
+func (c *Conn) keepalive(timeout time.Duration) bool {
+	errc := make(chan error, 1)
+
+	go func() {
+		_, _, err := c.SendRequest("keepalive@openssh.com", true, nil)
+		errc <- err
+	}()
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case err := <-errc:
+		return err == nil
+	case <-t.C:
+		return false
+	}
 }
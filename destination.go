@@ -0,0 +1,238 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Destination is a parsed ssh destination.
+type Destination struct {
+	User        string
+	Fingerprint string // host key fingerprint, as given in ssh:// URI
+	Host        string
+	Port        int
+	Path        string // remote path of scp-style host:path destination
+}
+
+// ParseDestination parses ssh destination given in one of the forms:
+//
+//	ssh://[user[;fingerprint=...]@]host[:port]
+//	[user@]host[:port]
+//	[user@]host:path
+//
+// IPv6 addresses must be enclosed in square brackets in order to be
+// followed by a port or a path. A suffix of a host that consists of
+// digits only is a port, otherwise it is a path.
+func ParseDestination(s string) (*Destination, error) {
+	var (
+		d   *Destination
+		err error
+	)
+
+	if strings.HasPrefix(s, "ssh://") {
+		d, err = parseURI(s)
+	} else {
+		d, err = parseDestination(s)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination %q: %w", s, err)
+	}
+
+	return d, nil
+}
+
+func parseURI(s string) (*Destination, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Path != "" && u.Path != "/" {
+		return nil, errors.New("unexpected path")
+	}
+
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, errors.New("unexpected query or fragment")
+	}
+
+	d := &Destination{
+		Host: u.Hostname(),
+	}
+
+	if u.User != nil {
+		params := strings.Split(u.User.Username(), ";")
+
+		if params[0] == "" && len(params) == 1 {
+			return nil, errors.New("missing user")
+		}
+
+		d.User = params[0]
+
+		for _, param := range params[1:] {
+			if v := strings.TrimPrefix(param, "fingerprint="); v != param {
+				d.Fingerprint = v
+			}
+		}
+	}
+
+	if p := u.Port(); p != "" {
+		if d.Port, err = parsePort(p); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.Host == "" {
+		return nil, errors.New("missing host")
+	}
+
+	return d, nil
+}
+
+func parseDestination(s string) (*Destination, error) {
+	d := new(Destination)
+
+	// The user ends at the last '@' preceding the host.
+	end := len(s)
+	if i := strings.IndexAny(s, ":["); i != -1 {
+		end = i
+	}
+
+	if i := strings.LastIndex(s[:end], "@"); i != -1 {
+		if i == 0 {
+			return nil, errors.New("missing user")
+		}
+		d.User, s = s[:i], s[i+1:]
+	}
+
+	var (
+		tail   string
+		suffix bool
+	)
+
+	switch {
+	case strings.HasPrefix(s, "["):
+		i := strings.IndexRune(s, ']')
+		if i == -1 {
+			return nil, errors.New("missing ']' in address")
+		}
+
+		d.Host, tail = s[1:i], s[i+1:]
+
+		if tail != "" {
+			if tail[0] != ':' {
+				return nil, errors.New("unexpected characters after ']'")
+			}
+			tail, suffix = tail[1:], true
+		}
+	case strings.Count(s, ":") > 1 && isIP(s):
+		d.Host = s
+	default:
+		if i := strings.IndexRune(s, ':'); i != -1 {
+			s, tail, suffix = s[:i], s[i+1:], true
+		}
+
+		d.Host = s
+	}
+
+	if d.Host == "" {
+		return nil, errors.New("missing host")
+	}
+
+	if strings.ContainsAny(d.Host, " \t/") {
+		return nil, errors.New("invalid host")
+	}
+
+	if suffix && tail != "" {
+		if isDigits(tail) {
+			port, err := parsePort(tail)
+			if err != nil {
+				return nil, err
+			}
+			d.Port = port
+		} else {
+			d.Path = tail
+		}
+	}
+
+	return d, nil
+}
+
+// Address returns the host and port of the destination in the form
+// accepted by net.Dial, or the host only if the port is not set.
+func (d *Destination) Address() string {
+	if d.Port == 0 {
+		return d.Host
+	}
+	return net.JoinHostPort(d.Host, strconv.Itoa(d.Port))
+}
+
+func (d *Destination) String() string {
+	if d.Port == 0 && d.Fingerprint == "" {
+		s := d.Host
+
+		if strings.ContainsRune(s, ':') && d.Path != "" {
+			s = "[" + s + "]"
+		}
+
+		if d.User != "" {
+			s = d.User + "@" + s
+		}
+
+		if d.Path != "" {
+			s += ":" + d.Path
+		}
+
+		return s
+	}
+
+	var user string
+
+	if d.User != "" || d.Fingerprint != "" {
+		user = d.User
+		if d.Fingerprint != "" {
+			user += ";fingerprint=" + d.Fingerprint
+		}
+		user += "@"
+	}
+
+	// The zone of an IPv6 address is escaped, as in any URI.
+	host := d.Host
+	if strings.ContainsRune(host, ':') {
+		host = "[" + strings.Replace(host, "%", "%25", 1) + "]"
+	}
+
+	if d.Port != 0 {
+		host += ":" + strconv.Itoa(d.Port)
+	}
+
+	return "ssh://" + user + host
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, errors.New("invalid port " + strconv.Quote(s))
+	}
+	return port, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isIP(s string) bool {
+	if i := strings.IndexRune(s, '%'); i != -1 {
+		s = s[:i]
+	}
+	return net.ParseIP(s) != nil
+}
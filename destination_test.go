@@ -0,0 +1,119 @@
+package ssh_test
+
+import (
+	"testing"
+
+	"github.com/glaucusio/ssh"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseDestination(t *testing.T) {
+	tests := []struct {
+		s    string
+		want ssh.Destination
+	}{
+		{"web", ssh.Destination{Host: "web"}},
+		{"admin@web", ssh.Destination{User: "admin", Host: "web"}},
+		{"web:22", ssh.Destination{Host: "web", Port: 22}},
+		{"admin@web:2222", ssh.Destination{User: "admin", Host: "web", Port: 2222}},
+		{"admin@web:backup", ssh.Destination{User: "admin", Host: "web", Path: "backup"}},
+		{"web:/var/backup", ssh.Destination{Host: "web", Path: "/var/backup"}},
+		{"web:22a", ssh.Destination{Host: "web", Path: "22a"}},
+		{"web:", ssh.Destination{Host: "web"}},
+		{"alice@example.com@web", ssh.Destination{User: "alice@example.com", Host: "web"}},
+		{"alice@example.com@web:2222", ssh.Destination{User: "alice@example.com", Host: "web", Port: 2222}},
+		{"::1", ssh.Destination{Host: "::1"}},
+		{"fe80::1%eth0", ssh.Destination{Host: "fe80::1%eth0"}},
+		{"[::1]", ssh.Destination{Host: "::1"}},
+		{"[::1]:2200", ssh.Destination{Host: "::1", Port: 2200}},
+		{"root@[::1]:/tmp/file", ssh.Destination{User: "root", Host: "::1", Path: "/tmp/file"}},
+		{"[fe80::1%eth0]:2200", ssh.Destination{Host: "fe80::1%eth0", Port: 2200}},
+		{"ssh://web", ssh.Destination{Host: "web"}},
+		{"ssh://web/", ssh.Destination{Host: "web"}},
+		{"ssh://admin@web:2222", ssh.Destination{User: "admin", Host: "web", Port: 2222}},
+		{"ssh://admin;fingerprint=ssh-ed25519-c1-b1-30@web", ssh.Destination{
+			User: "admin", Fingerprint: "ssh-ed25519-c1-b1-30", Host: "web",
+		}},
+		{"ssh://;fingerprint=ssh-rsa-c1-b1@[::1]:2200", ssh.Destination{
+			Fingerprint: "ssh-rsa-c1-b1", Host: "::1", Port: 2200,
+		}},
+		{"ssh://admin@[fe80::1%25eth0]:22", ssh.Destination{User: "admin", Host: "fe80::1%eth0", Port: 22}},
+		{"ssh://alice%40example.com@web", ssh.Destination{User: "alice@example.com", Host: "web"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			got, err := ssh.ParseDestination(test.s)
+			if err != nil {
+				t.Fatalf("ParseDestination()=%s", err)
+			}
+
+			if !cmp.Equal(*got, test.want) {
+				t.Fatalf("got != want:\n%s", cmp.Diff(*got, test.want))
+			}
+		})
+	}
+}
+
+func TestParseDestinationErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"admin@",
+		"@web",
+		"web:0",
+		"web:65536",
+		"web:99999999999999999999",
+		"[::1]:0",
+		"[::1",
+		"[::1]x",
+		"[]:22",
+		"web host",
+		"ssh://",
+		"ssh://web:0",
+		"ssh://web:65536",
+		"ssh://web:port",
+		"ssh://web/path",
+		"ssh://web?x=1",
+		"ssh://web#x",
+		"ssh://admin@",
+		"ssh://@web",
+	} {
+		if d, err := ssh.ParseDestination(s); err == nil {
+			t.Errorf("ParseDestination(%q)=%+v: expected error", s, d)
+		}
+	}
+}
+
+func TestDestinationString(t *testing.T) {
+	for _, s := range []string{
+		"web",
+		"admin@web",
+		"alice@example.com@web",
+		"admin@web:backup",
+		"fe80::1%eth0",
+		"root@[::1]:/tmp/file",
+		"ssh://web:2222",
+		"ssh://admin@web:2222",
+		"ssh://admin;fingerprint=ssh-ed25519-c1-b1-30@web",
+		"ssh://admin;fingerprint=ssh-ed25519-c1-b1-30@[::1]:2200",
+		"ssh://[fe80::1%25eth0]:22",
+	} {
+		d, err := ssh.ParseDestination(s)
+		if err != nil {
+			t.Fatalf("ParseDestination(%q)=%s", s, err)
+		}
+
+		if got := d.String(); got != s {
+			t.Errorf("String()=%q, want %q", got, s)
+		}
+
+		rd, err := ssh.ParseDestination(d.String())
+		if err != nil {
+			t.Fatalf("ParseDestination(%q)=%s", d.String(), err)
+		}
+
+		if !cmp.Equal(rd, d) {
+			t.Errorf("round-trip of %q: got != want:\n%s", s, cmp.Diff(rd, d))
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package ssh
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/glaucusio/xerrors"
+)
+
+// ConfigError describes a failure of a config source, optionally pointing
+// at the file, the line and the keyword that caused it.
+type ConfigError struct {
+	Source  string // name of the config source, like "user config"
+	File    string
+	Line    int
+	Keyword string
+	Err     error
+}
+
+func (e *ConfigError) Error() string {
+	var parts []string
+
+	if e.Source != "" {
+		parts = append(parts, e.Source)
+	}
+
+	if e.File != "" {
+		if e.Line != 0 {
+			parts = append(parts, e.File+":"+strconv.Itoa(e.Line))
+		} else {
+			parts = append(parts, e.File)
+		}
+	} else if e.Line != 0 {
+		parts = append(parts, "line "+strconv.Itoa(e.Line))
+	}
+
+	if e.Keyword != "" {
+		parts = append(parts, e.Keyword)
+	}
+
+	if e.Err != nil {
+		parts = append(parts, e.Err.Error())
+	}
+
+	return strings.Join(parts, ": ")
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// MultiError holds the failures of all the config sources that were tried,
+// when none of them succeeded.
+//
+// It matches ErrConfigNotFound only if every source failed to find a config,
+// and any other error if any of the sources failed with it.
+type MultiError []error
+
+func (m MultiError) Error() string {
+	switch len(m) {
+	case 0:
+		return ErrConfigNotFound.Error()
+	case 1:
+		return m[0].Error()
+	}
+
+	var buf strings.Builder
+
+	buf.WriteString(strconv.Itoa(len(m)))
+	buf.WriteString(" config sources failed:")
+
+	for _, err := range m {
+		buf.WriteString("\n\t")
+		buf.WriteString(err.Error())
+	}
+
+	return buf.String()
+}
+
+// Is reports whether the error matches the target. For ErrConfigNotFound
+// all of the errors must match it, as a source that failed otherwise, for
+// example with a syntax error, might have had the config; an empty
+// MultiError matches it as well. Any other target matches if one of the
+// errors matches it.
+func (m MultiError) Is(target error) bool {
+	if target == ErrConfigNotFound {
+		for _, err := range m {
+			if !xerrors.Is(err, ErrConfigNotFound) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, err := range m {
+		if xerrors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m MultiError) As(target interface{}) bool {
+	for _, err := range m {
+		if xerrors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
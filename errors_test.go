@@ -0,0 +1,43 @@
+package ssh_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/glaucusio/ssh"
+	"github.com/glaucusio/xerrors"
+)
+
+func TestMultiErrorIs(t *testing.T) {
+	errDenied := errors.New("permission denied")
+
+	notFound := &ssh.ConfigError{Source: "user config", Err: ssh.ErrConfigNotFound}
+	denied := &ssh.ConfigError{Source: "system config", Err: errDenied}
+
+	tests := []struct {
+		name     string
+		err      error
+		notFound bool
+		denied   bool
+	}{
+		{"empty", ssh.MultiError{}, true, false},
+		{"not found", ssh.MultiError{notFound, ssh.ErrConfigNotFound}, true, false},
+		{"mixed", ssh.MultiError{notFound, denied}, false, true},
+		{"mixed reversed", ssh.MultiError{denied, notFound}, false, true},
+		{"denied", ssh.MultiError{denied}, false, true},
+		{"wrapped", fmt.Errorf("dial: %w", ssh.MultiError{notFound, denied}), false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := xerrors.Is(test.err, ssh.ErrConfigNotFound); got != test.notFound {
+				t.Errorf("Is(ErrConfigNotFound)=%t, want %t", got, test.notFound)
+			}
+
+			if got := xerrors.Is(test.err, errDenied); got != test.denied {
+				t.Errorf("Is(errDenied)=%t, want %t", got, test.denied)
+			}
+		})
+	}
+}
@@ -8,4 +8,5 @@ require (
 	github.com/spf13/cobra v0.0.5
 	github.com/spf13/pflag v1.0.5
 	golang.org/x/crypto v0.0.0-20200109152110-61a87790db17
+	gopkg.in/yaml.v3 v3.0.1
 )
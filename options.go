@@ -0,0 +1,218 @@
+package ssh
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// ConfigOption is an Option that has an ssh_config equivalent, given as
+// Keyword=value options in the form accepted by ssh -o.
+type ConfigOption interface {
+	Option
+	ConfigOptions() []string
+}
+
+// OptionFunc adapts a function to the Option interface.
+type OptionFunc func(*Config) *Config
+
+func (fn OptionFunc) Apply(cfg *Config) *Config {
+	return fn(cfg)
+}
+
+// Algorithms lists algorithms to use for a connection, in the order of
+// preference. Empty lists leave the configured algorithms intact.
+type Algorithms struct {
+	Ciphers      []string
+	MACs         []string
+	KeyExchanges []string
+	HostKeys     []string
+}
+
+type configOption struct {
+	apply   func(*Config)
+	options []string
+}
+
+func (o *configOption) Apply(cfg *Config) *Config {
+	o.apply(cfg)
+	return cfg
+}
+
+func (o *configOption) ConfigOptions() []string {
+	return o.options
+}
+
+func option(apply func(*Config), options ...string) ConfigOption {
+	return &configOption{apply: apply, options: options}
+}
+
+func WithUser(user string) Option {
+	return option(func(cfg *Config) {
+		cfg.User = user
+	}, "User="+user)
+}
+
+// WithPort replaces the port of the address.
+func WithPort(port int) Option {
+	return option(func(cfg *Config) {
+		host, _, err := net.SplitHostPort(cfg.Address)
+		if err != nil {
+			host = cfg.Address
+		}
+		cfg.Address = net.JoinHostPort(host, strconv.Itoa(port))
+	}, "Port="+strconv.Itoa(port))
+}
+
+// WithTimeout sets the timeout of establishing the connection.
+func WithTimeout(timeout time.Duration) Option {
+	return option(func(cfg *Config) {
+		cfg.Timeout = timeout
+	}, "ConnectTimeout="+strconv.Itoa(int((timeout+time.Second-1)/time.Second)))
+}
+
+func WithHostKeyCallback(cb ssh.HostKeyCallback) Option {
+	return OptionFunc(func(cfg *Config) *Config {
+		cfg.HostKeyCallback = cb
+		return cfg
+	})
+}
+
+// WithIdentityFiles adds public key auth with the private keys read from
+// the files. The files are read when the server asks for authentication,
+// which fails if any of them can not be read.
+func WithIdentityFiles(files ...string) Option {
+	options := make([]string, 0, len(files))
+	for _, file := range files {
+		options = append(options, "IdentityFile="+file)
+	}
+
+	return option(func(cfg *Config) {
+		cfg.Auth = append(cfg.Auth, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			signers := make([]ssh.Signer, 0, len(files))
+
+			for _, file := range files {
+				p, err := ioutil.ReadFile(file)
+				if err != nil {
+					return nil, fmt.Errorf("error reading %q file: %w", file, err)
+				}
+
+				signer, err := ssh.ParsePrivateKey(p)
+				if err != nil {
+					return nil, fmt.Errorf("error parsing %q file: %w", file, err)
+				}
+
+				signers = append(signers, signer)
+			}
+
+			return signers, nil
+		}))
+	}, options...)
+}
+
+// WithAgent adds public key auth with the keys held by the agent.
+func WithAgent(a agent.Agent) Option {
+	return OptionFunc(func(cfg *Config) *Config {
+		cfg.Auth = append(cfg.Auth, ssh.PublicKeysCallback(a.Signers))
+		return cfg
+	})
+}
+
+// WithJump sets the hosts to connect through, in the order they are
+// connected to, replacing the configured ones.
+func WithJump(destinations ...string) Option {
+	jump := "none"
+	if len(destinations) != 0 {
+		jump = strings.Join(destinations, ",")
+	}
+
+	return option(func(cfg *Config) {
+		cfg.Jump = append([]string(nil), destinations...)
+	}, "ProxyJump="+jump)
+}
+
+// WithHeartbeat enables sending keepalive requests to the server at the
+// interval and closing the connection after maxCount of them are missed.
+func WithHeartbeat(interval time.Duration, maxCount int) Option {
+	return option(func(cfg *Config) {
+		cfg.ServerAlive = Heartbeat{Interval: interval, MaxCount: maxCount}
+	}, "ServerAliveInterval="+strconv.Itoa(int(interval/time.Second)), "ServerAliveCountMax="+strconv.Itoa(maxCount))
+}
+
+// WithKeepAlive enables or disables TCP keepalives.
+func WithKeepAlive(keepAlive bool) Option {
+	v := "no"
+	if keepAlive {
+		v = "yes"
+	}
+
+	return option(func(cfg *Config) {
+		cfg.KeepAlive = keepAlive
+	}, "TCPKeepAlive="+v)
+}
+
+func WithAlgorithms(a Algorithms) Option {
+	var options []string
+
+	for _, alg := range []struct {
+		keyword string
+		list    []string
+	}{
+		{"Ciphers", a.Ciphers},
+		{"MACs", a.MACs},
+		{"KexAlgorithms", a.KeyExchanges},
+		{"HostKeyAlgorithms", a.HostKeys},
+	} {
+		if len(alg.list) != 0 {
+			options = append(options, alg.keyword+"="+strings.Join(alg.list, ","))
+		}
+	}
+
+	return option(func(cfg *Config) {
+		if len(a.Ciphers) != 0 {
+			cfg.Ciphers = a.Ciphers
+		}
+		if len(a.MACs) != 0 {
+			cfg.MACs = a.MACs
+		}
+		if len(a.KeyExchanges) != 0 {
+			cfg.KeyExchanges = a.KeyExchanges
+		}
+		if len(a.HostKeys) != 0 {
+			cfg.HostKeyAlgorithms = a.HostKeys
+		}
+	}, options...)
+}
+
+func WithBanner(cb ssh.BannerCallback) Option {
+	return OptionFunc(func(cfg *Config) *Config {
+		cfg.BannerCallback = cb
+		return cfg
+	})
+}
+
+func WithAuth(methods ...ssh.AuthMethod) Option {
+	return OptionFunc(func(cfg *Config) *Config {
+		return cfg.WithAuth(methods...)
+	})
+}
+
+// ConfigOptions returns the ssh_config equivalents of the options, skipping
+// the options that have none, like WithHostKeyCallback.
+func ConfigOptions(opts ...Option) []string {
+	var options []string
+
+	for _, opt := range opts {
+		if opt, ok := opt.(ConfigOption); ok {
+			options = append(options, opt.ConfigOptions()...)
+		}
+	}
+
+	return options
+}
@@ -0,0 +1,166 @@
+package ssh_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/glaucusio/ssh"
+	xssh "golang.org/x/crypto/ssh"
+)
+
+func TestOptions(t *testing.T) {
+	opts := []ssh.Option{
+		ssh.WithUser("deploy"),
+		ssh.WithPort(2222),
+		ssh.WithTimeout(10 * time.Second),
+		ssh.WithHostKeyCallback(xssh.InsecureIgnoreHostKey()),
+		ssh.WithJump("bastion", "admin@gateway:2200"),
+		ssh.WithHeartbeat(time.Minute, 5),
+		ssh.WithAlgorithms(ssh.Algorithms{Ciphers: []string{"aes256-ctr", "aes128-ctr"}}),
+	}
+
+	cfg := (&ssh.Config{Address: "web:22"}).With(opts...)
+
+	if cfg.User != "deploy" || cfg.Address != "web:2222" || cfg.Timeout != 10*time.Second ||
+		cfg.HostKeyCallback == nil || len(cfg.Jump) != 2 || cfg.ServerAlive.MaxCount != 5 ||
+		len(cfg.Ciphers) != 2 {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+
+	want := []string{
+		"User=deploy",
+		"Port=2222",
+		"ConnectTimeout=10",
+		"ProxyJump=bastion,admin@gateway:2200",
+		"ServerAliveInterval=60",
+		"ServerAliveCountMax=5",
+		"Ciphers=aes256-ctr,aes128-ctr",
+	}
+
+	if got := ssh.ConfigOptions(opts...); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestClientDialContext(t *testing.T) {
+	users := make(chan string, 1)
+
+	l := serve(t, func(conn *xssh.ServerConn) {
+		users <- conn.User()
+	})
+	defer l.Close()
+
+	base := &ssh.Config{
+		Network: "tcp",
+		Address: l.Addr().String(),
+	}
+	base.User = "nobody"
+
+	c := &ssh.Client{ConfigCallback: base.Callback()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := c.DialContext(ctx, "tcp", "web", ssh.WithUser("deploy"), ssh.WithHostKeyCallback(xssh.InsecureIgnoreHostKey()))
+	if err != nil {
+		t.Fatalf("DialContext()=%s", err)
+	}
+	defer conn.Close()
+
+	if user := <-users; user != "deploy" {
+		t.Fatalf("got %q, want %q", user, "deploy")
+	}
+
+	if base.User != "nobody" || base.HostKeyCallback != nil {
+		t.Fatalf("options modified the config returned by the callback: %+v", base)
+	}
+}
+
+func TestClientHeartbeat(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	// Blocking in fn keeps the server from handling the global requests,
+	// so the keepalives are never replied to, like with a dead peer.
+	l := serve(t, func(conn *xssh.ServerConn) {
+		<-stop
+	})
+	defer l.Close()
+
+	c := &ssh.Client{ConfigCallback: (&ssh.Config{Network: "tcp", Address: l.Addr().String()}).Callback()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := c.DialContext(ctx, "tcp", "web", ssh.WithHeartbeat(50*time.Millisecond, 2),
+		ssh.WithHostKeyCallback(xssh.InsecureIgnoreHostKey()))
+	if err != nil {
+		t.Fatalf("DialContext()=%s", err)
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+
+	go func() {
+		conn.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection was not closed after missed keepalives")
+	}
+}
+
+func serve(t *testing.T, fn func(*xssh.ServerConn)) net.Listener {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey()=%s", err)
+	}
+
+	signer, err := xssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("NewSignerFromKey()=%s", err)
+	}
+
+	cfg := &xssh.ServerConfig{NoClientAuth: true}
+	cfg.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen()=%s", err)
+	}
+
+	go func() {
+		for {
+			nc, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				conn, chans, reqs, err := xssh.NewServerConn(nc, cfg)
+				if err != nil {
+					nc.Close()
+					return
+				}
+
+				fn(conn)
+
+				go xssh.DiscardRequests(reqs)
+
+				for ch := range chans {
+					ch.Reject(xssh.Prohibited, "not supported")
+				}
+			}()
+		}
+	}()
+
+	return l
+}
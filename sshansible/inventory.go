@@ -0,0 +1,386 @@
+// Package sshansible resolves ssh configuration of hosts described in
+// Ansible inventories.
+package sshansible
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/glaucusio/ssh"
+	"github.com/glaucusio/ssh/sshfile"
+)
+
+type vars map[string]interface{}
+
+type group struct {
+	vars     vars
+	children map[string]struct{}
+	parents  map[string]struct{}
+	hosts    map[string]struct{}
+}
+
+type host struct {
+	vars   vars
+	groups map[string]struct{}
+}
+
+// Inventory is a parsed Ansible inventory.
+type Inventory struct {
+	file   string
+	groups map[string]*group
+	hosts  map[string]*host
+}
+
+func newInventory(file string) *Inventory {
+	inv := &Inventory{
+		file:   file,
+		groups: make(map[string]*group),
+		hosts:  make(map[string]*host),
+	}
+
+	inv.group("all")
+	inv.group("ungrouped")
+	inv.addChild("all", "ungrouped")
+
+	return inv
+}
+
+// ParseFile parses an inventory file, either in YAML format if it has
+// .yml, .yaml or .json extension, or in INI format otherwise, together
+// with group_vars and host_vars directories placed next to it.
+func ParseFile(path string) (*Inventory, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	inv := newInventory(path)
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml", ".json":
+		err = inv.parseYAML(f)
+	default:
+		err = inv.parseINI(f)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", path, err)
+	}
+
+	if err := inv.LoadVars(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+
+	return inv, nil
+}
+
+func (inv *Inventory) group(name string) *group {
+	g, ok := inv.groups[name]
+	if !ok {
+		g = &group{
+			vars:     make(vars),
+			children: make(map[string]struct{}),
+			parents:  make(map[string]struct{}),
+			hosts:    make(map[string]struct{}),
+		}
+		inv.groups[name] = g
+	}
+	return g
+}
+
+func (inv *Inventory) host(name string) *host {
+	h, ok := inv.hosts[name]
+	if !ok {
+		h = &host{
+			vars:   make(vars),
+			groups: make(map[string]struct{}),
+		}
+		inv.hosts[name] = h
+	}
+	return h
+}
+
+func (inv *Inventory) addHost(groupName, hostName string) *host {
+	h := inv.host(hostName)
+	inv.group(groupName).hosts[hostName] = struct{}{}
+	h.groups[groupName] = struct{}{}
+	return h
+}
+
+func (inv *Inventory) addChild(parent, child string) {
+	inv.group(parent).children[child] = struct{}{}
+	inv.group(child).parents[parent] = struct{}{}
+}
+
+// finish places the groups without parents under all and the hosts
+// without groups under ungrouped, as Ansible does.
+func (inv *Inventory) finish() {
+	for name, g := range inv.groups {
+		if name != "all" && len(g.parents) == 0 {
+			inv.addChild("all", name)
+		}
+	}
+
+	for name, h := range inv.hosts {
+		if len(h.groups) == 0 || (len(h.groups) == 1 && has(h.groups, "all")) {
+			delete(inv.group("all").hosts, name)
+			delete(h.groups, "all")
+			inv.addHost("ungrouped", name)
+		}
+	}
+}
+
+// Hosts returns sorted names of the hosts that belong to the group,
+// directly or through its children.
+func (inv *Inventory) Hosts(name string) []string {
+	hosts := make(map[string]struct{})
+
+	inv.walkDown(name, make(map[string]struct{}), func(g *group) {
+		for h := range g.hosts {
+			hosts[h] = struct{}{}
+		}
+	})
+
+	if name == "all" {
+		for h := range inv.hosts {
+			hosts[h] = struct{}{}
+		}
+	}
+
+	return sortedKeys(hosts)
+}
+
+// Groups returns sorted names of the groups the host belongs to, directly
+// or through their parents, or nil if the host is not in the inventory.
+func (inv *Inventory) Groups(host string) []string {
+	h, ok := inv.hosts[host]
+	if !ok {
+		return nil
+	}
+
+	groups := make(map[string]struct{})
+
+	for name := range h.groups {
+		inv.walkUp(name, groups)
+	}
+
+	groups["all"] = struct{}{}
+
+	return sortedKeys(groups)
+}
+
+// AllGroups returns sorted names of all groups of the inventory.
+func (inv *Inventory) AllGroups() []string {
+	groups := make(map[string]struct{}, len(inv.groups))
+	for name := range inv.groups {
+		groups[name] = struct{}{}
+	}
+	return sortedKeys(groups)
+}
+
+func (inv *Inventory) walkDown(name string, seen map[string]struct{}, fn func(*group)) {
+	g, ok := inv.groups[name]
+	if !ok || has(seen, name) {
+		return
+	}
+
+	seen[name] = struct{}{}
+	fn(g)
+
+	for child := range g.children {
+		inv.walkDown(child, seen, fn)
+	}
+}
+
+func (inv *Inventory) walkUp(name string, seen map[string]struct{}) {
+	g, ok := inv.groups[name]
+	if !ok || has(seen, name) {
+		return
+	}
+
+	seen[name] = struct{}{}
+
+	for parent := range g.parents {
+		inv.walkUp(parent, seen)
+	}
+}
+
+// depth returns the length of the longest path from all to the group.
+func (inv *Inventory) depth(name string, seen map[string]struct{}) int {
+	if name == "all" || has(seen, name) {
+		return 0
+	}
+
+	seen[name] = struct{}{}
+	defer delete(seen, name)
+
+	var d int
+
+	for parent := range inv.groups[name].parents {
+		if n := inv.depth(parent, seen) + 1; n > d {
+			d = n
+		}
+	}
+
+	return d
+}
+
+// Vars returns the variables of the host, with the variables of its groups
+// applied in the order of their depth, so the variables of child groups
+// override the ones of their parents and the variables of the host
+// override all of them.
+func (inv *Inventory) Vars(host string) map[string]interface{} {
+	h, ok := inv.hosts[host]
+	if !ok {
+		return nil
+	}
+
+	groups := inv.Groups(host)
+	depths := make(map[string]int, len(groups))
+
+	for _, name := range groups {
+		depths[name] = inv.depth(name, make(map[string]struct{}))
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return depths[groups[i]] < depths[groups[j]]
+	})
+
+	v := make(map[string]interface{})
+
+	for _, name := range groups {
+		for k, val := range inv.groups[name].vars {
+			v[k] = val
+		}
+	}
+
+	for k, val := range h.vars {
+		v[k] = val
+	}
+
+	return v
+}
+
+// Config returns the ssh configuration of the host built from its
+// connection variables.
+func (inv *Inventory) Config(host string) (*sshfile.Config, error) {
+	v := inv.Vars(host)
+	if v == nil {
+		return nil, ssh.ErrConfigNotFound
+	}
+
+	var args []string
+
+	for _, k := range []string{"ansible_ssh_common_args", "ansible_ssh_extra_args"} {
+		if s, ok := lookup(v, k); ok {
+			words, err := sshfile.SplitArgs(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid %s: %w", host, k, err)
+			}
+			args = append(args, words...)
+		}
+	}
+
+	parsed, err := sshfile.ParseArgs(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", host, err)
+	}
+
+	var options []string
+
+	for _, opt := range []struct {
+		keyword string
+		vars    []string
+	}{
+		{"HostName", []string{"ansible_host", "ansible_ssh_host"}},
+		{"Port", []string{"ansible_port", "ansible_ssh_port"}},
+		{"User", []string{"ansible_user", "ansible_ssh_user"}},
+		{"IdentityFile", []string{"ansible_ssh_private_key_file", "ansible_private_key_file"}},
+	} {
+		for _, k := range opt.vars {
+			if s, ok := lookup(v, k); ok {
+				options = append(options, opt.keyword+"="+s)
+				break
+			}
+		}
+	}
+
+	explicit, err := sshfile.ParseOptions(options)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", host, err)
+	}
+
+	// Like Ansible, which passes the connection variables to ssh before
+	// the extra arguments, prefer them over the ones set by the arguments.
+	cfg := parsed.Config
+
+	if err := cfg.Merge(explicit); err != nil {
+		return nil, fmt.Errorf("%s: %w", host, err)
+	}
+
+	for k := range cfg.Origins {
+		cfg.Origins[k] = sshfile.Origin{File: inv.file, Block: "host " + host}
+	}
+
+	return cfg, nil
+}
+
+// Configs returns the ssh configurations of all the hosts of the inventory.
+func (inv *Inventory) Configs() (sshfile.Configs, error) {
+	var configs sshfile.Configs
+
+	for _, name := range inv.Hosts("all") {
+		cfg, err := inv.Config(name)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.Host = sshfile.Host{Regexp: regexp.MustCompile("^" + regexp.QuoteMeta(name) + "$")}
+
+		configs = append(configs, cfg)
+	}
+
+	return configs, nil
+}
+
+// Callback returns a callback that resolves hosts of the inventory and
+// fails with ssh.ErrConfigNotFound for the other ones, so it can be
+// composed with sshutil.Callback.
+func (inv *Inventory) Callback() ssh.ConfigCallback {
+	configs, err := inv.Configs()
+	if err != nil {
+		return func(context.Context, string, string) (*ssh.Config, error) {
+			return nil, err
+		}
+	}
+
+	return configs.Callback()
+}
+
+func lookup(v vars, k string) (string, bool) {
+	val, ok := v[k]
+	if !ok || val == nil {
+		return "", false
+	}
+	return fmt.Sprint(val), true
+}
+
+func has(m map[string]struct{}, k string) bool {
+	_, ok := m[k]
+	return ok
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
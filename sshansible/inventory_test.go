@@ -0,0 +1,134 @@
+package sshansible_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/glaucusio/ssh"
+	"github.com/glaucusio/ssh/sshansible"
+	"github.com/glaucusio/ssh/sshfile"
+	"github.com/glaucusio/xerrors"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestParseFile(t *testing.T) {
+	configs := map[string]*sshfile.Config{
+		"bastion.example.com": {
+			Hostname: "10.0.0.1",
+			User:     "admin",
+		},
+		"web01.example.com": {
+			User:         "deploy",
+			IdentityFile: sshfile.Strings{"~/.ssh/id_web"},
+			ProxyJump:    "bastion.example.com",
+			Compression:  sshfile.Boolean(true),
+		},
+		"web02.example.com": {
+			User:         "deploy",
+			Port:         2222,
+			IdentityFile: sshfile.Strings{"~/.ssh/id_web"},
+			ProxyJump:    "bastion.example.com",
+			Compression:  sshfile.Boolean(true),
+		},
+		"web-canary.example.com": {
+			User:                  "deploy",
+			Port:                  2200,
+			IdentityFile:          sshfile.Strings{"~/.ssh/id_web"},
+			StrictHostKeyChecking: sshfile.HostKeyCheckingAcceptNew,
+		},
+		"db-b.example.com": {
+			User:         "deploy",
+			IdentityFile: sshfile.Strings{"~/.ssh/id db"},
+			ProxyJump:    "bastion.example.com",
+			Compression:  sshfile.Boolean(true),
+		},
+	}
+
+	groups := map[string][]string{
+		"bastion.example.com":    {"all", "ungrouped"},
+		"web03.example.com":      {"all", "prod", "web"},
+		"db-a.example.com":       {"all", "db", "prod"},
+		"missing.example.com":    nil,
+		"web-canary.example.com": {"all", "prod", "web"},
+	}
+
+	hosts := map[string][]string{
+		"all":       {"bastion.example.com", "db-a.example.com", "db-b.example.com", "web-canary.example.com", "web01.example.com", "web02.example.com", "web03.example.com"},
+		"prod":      {"db-a.example.com", "db-b.example.com", "web-canary.example.com", "web01.example.com", "web02.example.com", "web03.example.com"},
+		"db":        {"db-a.example.com", "db-b.example.com"},
+		"ungrouped": {"bastion.example.com"},
+		"missing":   {},
+	}
+
+	ignore := cmpopts.IgnoreFields(sshfile.Config{}, "Origins", "Host")
+
+	for _, file := range []string{"testdata/hosts", "testdata/hosts.yml"} {
+		t.Run(file, func(t *testing.T) {
+			inv, err := sshansible.ParseFile(file)
+			if err != nil {
+				t.Fatalf("ParseFile()=%s", err)
+			}
+
+			for host, want := range configs {
+				got, err := inv.Config(host)
+				if err != nil {
+					t.Fatalf("Config(%q)=%s", host, err)
+				}
+
+				if !cmp.Equal(got, want, ignore) {
+					t.Errorf("Config(%q): got != want:\n%s", host, cmp.Diff(got, want, ignore))
+				}
+			}
+
+			for host, want := range groups {
+				if got := inv.Groups(host); !cmp.Equal(got, want) {
+					t.Errorf("Groups(%q): got != want:\n%s", host, cmp.Diff(got, want))
+				}
+			}
+
+			for group, want := range hosts {
+				if got := inv.Hosts(group); !cmp.Equal(got, want) {
+					t.Errorf("Hosts(%q): got != want:\n%s", group, cmp.Diff(got, want))
+				}
+			}
+
+			cb := inv.Callback()
+
+			cfg, err := cb(context.Background(), "tcp", "bastion.example.com:22")
+			if err != nil {
+				t.Fatalf("Callback()=%s", err)
+			}
+
+			if cfg.User != "admin" {
+				t.Errorf("got %q, want %q", cfg.User, "admin")
+			}
+
+			if _, err := cb(context.Background(), "tcp", "web.example.com:22"); !xerrors.Is(err, ssh.ErrConfigNotFound) {
+				t.Errorf("got %v, want %v", err, ssh.ErrConfigNotFound)
+			}
+		})
+	}
+}
+
+func TestParseINIErrors(t *testing.T) {
+	tests := map[string]string{
+		"unterminated section": "[web\nweb01\n",
+		"unsupported section":  "[web:hosts]\nweb01\n",
+		"invalid vars":         "[web:vars]\nansible_user\n",
+		"invalid host vars":    "web01 ansible_user\n",
+		"unterminated quote":   "web01 ansible_user='deploy\n",
+		"invalid range":        "web[01:xx]\n",
+		"invalid step":         "web[01:10:0]\n",
+		"missing bracket":      "web[01:10\n",
+	}
+
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := sshansible.ParseINI(strings.NewReader(input)); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,360 @@
+package sshansible
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/glaucusio/ssh/sshfile"
+
+	"gopkg.in/yaml.v3"
+)
+
+func ParseINI(r io.Reader) (*Inventory, error) {
+	inv := newInventory("")
+	if err := inv.parseINI(r); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+func ParseYAML(r io.Reader) (*Inventory, error) {
+	inv := newInventory("")
+	if err := inv.parseYAML(r); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+func (inv *Inventory) parseINI(r io.Reader) error {
+	const (
+		sectionHosts = iota
+		sectionVars
+		sectionChildren
+	)
+
+	var (
+		name    = "ungrouped"
+		section = sectionHosts
+		lineno  int
+	)
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		lineno++
+
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+			continue
+		case strings.HasPrefix(line, "["):
+			if !strings.HasSuffix(line, "]") {
+				return fmt.Errorf("line %d: unterminated section %q", lineno, line)
+			}
+
+			name, section = line[1:len(line)-1], sectionHosts
+
+			if i := strings.LastIndex(name, ":"); i != -1 {
+				switch name[i+1:] {
+				case "vars":
+					section = sectionVars
+				case "children":
+					section = sectionChildren
+				default:
+					return fmt.Errorf("line %d: unsupported section %q", lineno, line)
+				}
+				name = name[:i]
+			}
+
+			inv.group(name)
+		case section == sectionVars:
+			i := strings.IndexRune(line, '=')
+			if i == -1 {
+				return fmt.Errorf("line %d: expected key=value, got %q", lineno, line)
+			}
+
+			inv.group(name).vars[strings.TrimSpace(line[:i])] = unquote(strings.TrimSpace(line[i+1:]))
+		case section == sectionChildren:
+			inv.addChild(name, line)
+		default:
+			words, err := sshfile.SplitArgs(line)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", lineno, err)
+			}
+
+			pattern, port := words[0], ""
+
+			if i := strings.LastIndex(pattern, ":"); i > strings.LastIndex(pattern, "]") && isDigits(pattern[i+1:]) {
+				pattern, port = pattern[:i], pattern[i+1:]
+			}
+
+			hosts, err := expandHosts(pattern)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", lineno, err)
+			}
+
+			for _, h := range hosts {
+				h := inv.addHost(name, h)
+
+				if port != "" {
+					h.vars["ansible_port"] = port
+				}
+
+				for _, kv := range words[1:] {
+					i := strings.IndexRune(kv, '=')
+					if i == -1 {
+						return fmt.Errorf("line %d: expected key=value, got %q", lineno, kv)
+					}
+
+					h.vars[kv[:i]] = kv[i+1:]
+				}
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	inv.finish()
+
+	return nil
+}
+
+type yamlGroup struct {
+	Hosts    map[string]map[string]interface{} `yaml:"hosts"`
+	Vars     map[string]interface{}            `yaml:"vars"`
+	Children map[string]*yamlGroup             `yaml:"children"`
+}
+
+func (inv *Inventory) parseYAML(r io.Reader) error {
+	var doc map[string]*yamlGroup
+
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil && err != io.EOF {
+		return err
+	}
+
+	for name, g := range doc {
+		if err := inv.yamlGroup(name, g); err != nil {
+			return err
+		}
+	}
+
+	inv.finish()
+
+	return nil
+}
+
+func (inv *Inventory) yamlGroup(name string, g *yamlGroup) error {
+	grp := inv.group(name)
+
+	if g == nil {
+		return nil
+	}
+
+	for k, v := range g.Vars {
+		grp.vars[k] = v
+	}
+
+	for pattern, vars := range g.Hosts {
+		hosts, err := expandHosts(pattern)
+		if err != nil {
+			return fmt.Errorf("group %q: %w", name, err)
+		}
+
+		for _, h := range hosts {
+			h := inv.addHost(name, h)
+
+			for k, v := range vars {
+				h.vars[k] = v
+			}
+		}
+	}
+
+	for child, g := range g.Children {
+		inv.addChild(name, child)
+
+		if err := inv.yamlGroup(child, g); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadVars loads variables of the groups and the hosts of the inventory
+// from group_vars and host_vars subdirectories of the given directory.
+// Each of them can be either a file named after the group or host, with
+// optional .yml, .yaml or .json extension, or a directory of such files.
+// The variables override the ones set in the inventory.
+func (inv *Inventory) LoadVars(dir string) error {
+	for _, name := range inv.AllGroups() {
+		if err := loadVars(filepath.Join(dir, "group_vars", name), inv.groups[name].vars); err != nil {
+			return err
+		}
+	}
+
+	for name, h := range inv.hosts {
+		if err := loadVars(filepath.Join(dir, "host_vars", name), h.vars); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func loadVars(path string, v vars) error {
+	var files []string
+
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		infos, err := ioutil.ReadDir(path)
+		if err != nil {
+			return err
+		}
+
+		for _, fi := range infos {
+			if !fi.IsDir() && isVarsFile(fi.Name()) {
+				files = append(files, filepath.Join(path, fi.Name()))
+			}
+		}
+	} else {
+		for _, ext := range []string{"", ".yml", ".yaml", ".json"} {
+			if fi, err := os.Stat(path + ext); err == nil && !fi.IsDir() {
+				files = append(files, path+ext)
+			}
+		}
+	}
+
+	for _, file := range files {
+		p, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		var m map[string]interface{}
+
+		if err := yaml.Unmarshal(p, &m); err != nil {
+			return fmt.Errorf("failed to parse %q: %w", file, err)
+		}
+
+		for k, val := range m {
+			v[k] = val
+		}
+	}
+
+	return nil
+}
+
+func isVarsFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case "", ".yml", ".yaml", ".json":
+		return !strings.HasPrefix(name, ".")
+	}
+	return false
+}
+
+// expandHosts expands ranges in host patterns, like www[01:50].example.com
+// or db-[a:f].example.com, with an optional step, like [1:10:2].
+func expandHosts(pattern string) ([]string, error) {
+	i := strings.IndexRune(pattern, '[')
+	if i == -1 {
+		return []string{pattern}, nil
+	}
+
+	j := strings.IndexRune(pattern[i:], ']')
+	if j == -1 {
+		return nil, fmt.Errorf("invalid host pattern %q: missing ']'", pattern)
+	}
+
+	j += i
+
+	bounds := strings.Split(pattern[i+1:j], ":")
+	if len(bounds) != 2 && len(bounds) != 3 {
+		return nil, fmt.Errorf("invalid host pattern %q: invalid range", pattern)
+	}
+
+	step := 1
+
+	if len(bounds) == 3 {
+		n, err := strconv.Atoi(bounds[2])
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid host pattern %q: invalid step", pattern)
+		}
+		step = n
+	}
+
+	items, err := expandRange(bounds[0], bounds[1], step)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host pattern %q: %w", pattern, err)
+	}
+
+	rest, err := expandHosts(pattern[j+1:])
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []string
+
+	for _, item := range items {
+		for _, r := range rest {
+			hosts = append(hosts, pattern[:i]+item+r)
+		}
+	}
+
+	return hosts, nil
+}
+
+func expandRange(begin, end string, step int) ([]string, error) {
+	var items []string
+
+	if b, err := strconv.Atoi(begin); err == nil {
+		e, err := strconv.Atoi(end)
+		if err != nil || e < b {
+			return nil, errors.New("invalid numeric range")
+		}
+
+		for n := b; n <= e; n += step {
+			s := strconv.Itoa(n)
+			if len(s) < len(begin) {
+				s = strings.Repeat("0", len(begin)-len(s)) + s
+			}
+			items = append(items, s)
+		}
+
+		return items, nil
+	}
+
+	if len(begin) != 1 || len(end) != 1 || begin[0] > end[0] {
+		return nil, errors.New("invalid alphabetic range")
+	}
+
+	for c := int(begin[0]); c <= int(end[0]); c += step {
+		items = append(items, string(rune(c)))
+	}
+
+	return items, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
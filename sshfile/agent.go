@@ -0,0 +1,227 @@
+package sshfile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// AgentAuth returns public key auth with the keys held by the agent listening
+// on the socket, the ones matching the identity files first and in their
+// order, followed by the keys read from the identity files which the agent
+// does not hold. With identitiesOnly set, only the agent keys matching
+// the identity files are used. Identity files encrypted with
+// a passphrase can be used only through the agent.
+//
+// An empty socket, like the one of an unset SSH_AUTH_SOCK, skips the agent.
+// Otherwise it is an error if the agent can not be connected to.
+func AgentAuth(socket string, identitiesOnly bool, files ...string) (ssh.AuthMethod, error) {
+	if socket != "" {
+		if err := checkAgent(socket); err != nil {
+			return nil, err
+		}
+	}
+
+	ids := loadIdentities(files...)
+
+	return ssh.PublicKeysCallback(agentSigners(socket, identitiesOnly, nil, ids)), nil
+}
+
+type identity struct {
+	key    ssh.PublicKey
+	signer ssh.Signer // nil for encrypted keys
+}
+
+// loadIdentities reads the identity files, skipping the ones which
+// are missing, unreadable or malformed, like ssh does. Public keys
+// of the encrypted ones are read from their .pub files, they are
+// skipped if there is none.
+func loadIdentities(files ...string) []identity {
+	var ids []identity
+
+	for _, file := range files {
+		p, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+
+		signer, err := ssh.ParsePrivateKey(p)
+		if _, ok := err.(*ssh.PassphraseMissingError); ok {
+			if key := publicKey(file); key != nil {
+				ids = append(ids, identity{key: key})
+			}
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		ids = append(ids, identity{key: signer.PublicKey(), signer: signer})
+	}
+
+	return ids
+}
+
+func publicKey(file string) ssh.PublicKey {
+	p, err := ioutil.ReadFile(file + ".pub")
+	if err != nil {
+		return nil
+	}
+
+	key, _, _, _, err := ssh.ParseAuthorizedKey(p)
+	if err != nil {
+		return nil
+	}
+
+	return key
+}
+
+// agentSigners orders the keys like OpenSSH does: certificates go first,
+// then the agent keys matching the identity files, in their order, then
+// the other agent keys, then the identity files not held by the agent.
+func agentSigners(socket string, identitiesOnly bool, certs []ssh.Signer, ids []identity) func() ([]ssh.Signer, error) {
+	return func() ([]ssh.Signer, error) {
+		signers := append([]ssh.Signer(nil), certs...)
+
+		keys, err := agentKeys(socket)
+		if err != nil {
+			keys = nil // fall back to the identity files
+		}
+
+		var (
+			held  = make(map[int]bool)
+			files []ssh.Signer
+		)
+
+		for _, id := range ids {
+			i := indexKey(keys, id.key)
+
+			switch {
+			case i == -1 && id.signer != nil:
+				files = append(files, id.signer)
+			case i != -1 && !held[i]:
+				held[i] = true
+				signers = append(signers, &agentSigner{socket: socket, key: keys[i]})
+			}
+		}
+
+		if !identitiesOnly {
+			for i, key := range keys {
+				if !held[i] {
+					signers = append(signers, &agentSigner{socket: socket, key: key})
+				}
+			}
+		}
+
+		signers = append(signers, files...)
+
+		if len(signers) == 0 {
+			return nil, NoAuthMethods
+		}
+
+		return signers, nil
+	}
+}
+
+func indexKey(keys []ssh.PublicKey, key ssh.PublicKey) int {
+	for i, k := range keys {
+		if bytes.Equal(k.Marshal(), key.Marshal()) {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkAgent reports an error if the agent listening on the socket can not
+// be connected to.
+func checkAgent(socket string) error {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return fmt.Errorf("failed to connect to agent: %w", err)
+	}
+	return conn.Close()
+}
+
+func agentKeys(socket string) ([]ssh.PublicKey, error) {
+	if socket == "" {
+		return nil, nil
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to agent: %w", err)
+	}
+	defer conn.Close()
+
+	list, err := agent.NewClient(conn).List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list agent keys: %w", err)
+	}
+
+	keys := make([]ssh.PublicKey, 0, len(list))
+	for _, key := range list {
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// agentSigner signs with a key held by the agent, connecting to it for
+// every signature, so no connection outlives the authentication.
+type agentSigner struct {
+	socket string
+	key    ssh.PublicKey
+}
+
+var _ ssh.AlgorithmSigner = (*agentSigner)(nil)
+
+func (s *agentSigner) PublicKey() ssh.PublicKey {
+	return s.key
+}
+
+func (s *agentSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	return s.SignWithAlgorithm(rand, data, "")
+}
+
+func (s *agentSigner) SignWithAlgorithm(_ io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	var flags agent.SignatureFlags
+
+	switch algorithm {
+	case ssh.SigAlgoRSASHA2256:
+		flags = agent.SignatureFlagRsaSha256
+	case ssh.SigAlgoRSASHA2512:
+		flags = agent.SignatureFlagRsaSha512
+	}
+
+	conn, err := net.Dial("unix", s.socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to agent: %w", err)
+	}
+	defer conn.Close()
+
+	return agent.NewClient(conn).SignWithFlags(s.key, data, flags)
+}
+
+// agentSocket returns path of the agent socket set by IdentityAgent,
+// or by the SSH_AUTH_SOCK environment variable by default, or an empty
+// string if the agent is disabled. The explicit result reports whether
+// the socket was configured rather than taken from SSH_AUTH_SOCK.
+func (c *Config) agentSocket() (socket string, explicit bool) {
+	switch socket := c.IdentityAgent; {
+	case socket == "none":
+		return "", false
+	case socket == "" || socket == "SSH_AUTH_SOCK":
+		return os.Getenv("SSH_AUTH_SOCK"), false
+	case strings.HasPrefix(socket, "$"):
+		return os.Getenv(strings.Trim(socket[1:], "{}")), true
+	default:
+		return socket, true
+	}
+}
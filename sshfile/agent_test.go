@@ -0,0 +1,308 @@
+package sshfile_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/glaucusio/ssh"
+	"github.com/glaucusio/ssh/sshfile"
+	"github.com/google/go-cmp/cmp"
+	xssh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestConfigAgentAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshfile")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	keys := make(map[string]*ecdsa.PrivateKey)
+	names := make(map[string]string)
+
+	for _, name := range []string{"file", "both", "second", "agent"} {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("GenerateKey()=%s", err)
+		}
+
+		pub, err := xssh.NewPublicKey(&key.PublicKey)
+		if err != nil {
+			t.Fatalf("NewPublicKey()=%s", err)
+		}
+
+		keys[name] = key
+		names[string(pub.Marshal())] = name
+
+		if name == "agent" {
+			continue
+		}
+
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatalf("MarshalECPrivateKey()=%s", err)
+		}
+
+		p := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+
+		if err := ioutil.WriteFile(filepath.Join(dir, "id_"+name), p, 0600); err != nil {
+			t.Fatalf("WriteFile()=%s", err)
+		}
+	}
+
+	encrypted, err := x509.EncryptPEMBlock(rand.Reader, "EC PRIVATE KEY", []byte("key"), []byte("secret"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatalf("EncryptPEMBlock()=%s", err)
+	}
+
+	for name, p := range map[string][]byte{
+		"id_encrypted": pem.EncodeToMemory(encrypted),
+		"id_malformed": []byte("not a key"),
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), p, 0600); err != nil {
+			t.Fatalf("WriteFile()=%s", err)
+		}
+	}
+
+	keyring := agent.NewKeyring()
+
+	// The agent holds the keys in other order than the config names them.
+	for _, name := range []string{"agent", "second", "both"} {
+		if err := keyring.Add(agent.AddedKey{PrivateKey: keys[name]}); err != nil {
+			t.Fatalf("Add()=%s", err)
+		}
+	}
+
+	socket := filepath.Join(dir, "agent.sock")
+
+	al, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Listen()=%s", err)
+	}
+	defer al.Close()
+
+	go func() {
+		for {
+			conn, err := al.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				_ = agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+
+	offered, l := serveKeys(t)
+	defer l.Close()
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+
+	cases := map[string]struct {
+		config string
+		want   []string
+	}{
+		"agent keys first": {
+			"IdentityAgent " + socket,
+			[]string{"both", "agent", "second", "file"},
+		},
+		"agent keys in config order": {
+			"IdentityAgent " + socket + "\n\tIdentityFile " + filepath.Join(dir, "id_second"),
+			[]string{"both", "second", "agent", "file"},
+		},
+		"identities only": {
+			"IdentityAgent " + socket + "\n\tIdentitiesOnly yes",
+			[]string{"both", "file"},
+		},
+		"no agent": {
+			"IdentityAgent none",
+			[]string{"file", "both"},
+		},
+		"no agent with bad identity files": {
+			"IdentityAgent none\n\tIdentityFile " + filepath.Join(dir, "id_missing") +
+				"\n\tIdentityFile " + filepath.Join(dir, "id_malformed") +
+				"\n\tIdentityFile " + filepath.Join(dir, "id_encrypted"),
+			[]string{"file", "both"},
+		},
+	}
+
+	for name, cas := range cases {
+		t.Run(name, func(t *testing.T) {
+			config := fmt.Sprintf("Host web\n\tHostname %s\n\tPort %s\n\tStrictHostKeyChecking no\n\t"+
+				"IdentityFile %s\n\tIdentityFile %s\n\t%s\n",
+				host, port, filepath.Join(dir, "id_file"), filepath.Join(dir, "id_both"), cas.config)
+
+			cfgs, err := (&sshfile.Parser{}).ParseConfig(strings.NewReader(config))
+			if err != nil {
+				t.Fatalf("ParseConfig()=%s", err)
+			}
+
+			cfg, err := cfgs.Callback()(context.Background(), "tcp", "web")
+			if err != nil {
+				t.Fatalf("Callback()=%s", err)
+			}
+
+			if _, err := xssh.Dial("tcp", cfg.Address, &cfg.ClientConfig); err == nil {
+				t.Fatal("expected Dial() to fail")
+			}
+
+			var got []string
+
+			for key := range offered {
+				if key == nil {
+					break
+				}
+				got = append(got, names[string(key.Marshal())])
+			}
+
+			if !cmp.Equal(got, cas.want) {
+				t.Fatalf("got %q, want %q", got, cas.want)
+			}
+		})
+	}
+}
+
+func TestAgentAuthErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshfile")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "agent.sock")
+
+	if _, err := sshfile.AgentAuth("", false); err != nil {
+		t.Fatalf("AgentAuth()=%s", err)
+	}
+
+	if _, err := sshfile.AgentAuth(socket, false); err == nil {
+		t.Fatal("expected AgentAuth() to fail")
+	}
+
+	const config = "Host web\n\tStrictHostKeyChecking no\n\tIdentityAgent %s\n"
+
+	for socket, fail := range map[string]bool{
+		socket:          true,
+		"none":          false,
+		"SSH_AUTH_SOCK": false,
+	} {
+		cfgs, err := (&sshfile.Parser{}).ParseConfig(strings.NewReader(fmt.Sprintf(config, socket)))
+		if err != nil {
+			t.Fatalf("ParseConfig()=%s", err)
+		}
+
+		if _, err := cfgs.Callback()(context.Background(), "tcp", "web"); (err != nil) != fail {
+			t.Errorf("%s: got %v error, want failure=%t", socket, err, fail)
+		}
+	}
+}
+
+func TestConfigOptionsIdentityFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshfile")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	key := mustKey(t)
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey()=%s", err)
+	}
+
+	p := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "id_work"), p, 0600); err != nil {
+		t.Fatalf("WriteFile()=%s", err)
+	}
+
+	os.Setenv("GOSSH_TEST_DIR", dir)
+	defer os.Unsetenv("GOSSH_TEST_DIR")
+
+	offered, l := serveKeys(t)
+	defer l.Close()
+
+	cfg := &sshfile.Config{
+		IdentityFile: sshfile.Strings{"${GOSSH_TEST_DIR}/id_missing", "${GOSSH_TEST_DIR}/id_work"},
+	}
+
+	c := (&ssh.Config{}).With(cfg.Options()...)
+	c.HostKeyCallback = xssh.InsecureIgnoreHostKey()
+
+	if _, err := xssh.Dial("tcp", l.Addr().String(), &c.ClientConfig); err == nil {
+		t.Fatal("expected Dial() to fail")
+	}
+
+	pub, err := xssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("NewPublicKey()=%s", err)
+	}
+
+	got := <-offered
+	if got == nil || string(got.Marshal()) != string(pub.Marshal()) {
+		t.Fatalf("got %v key offered, want the id_work key", got)
+	}
+}
+
+// serveKeys serves ssh connections, rejecting all public keys and sending
+// them to the channel, followed by nil once the connection is closed.
+func serveKeys(t *testing.T) (<-chan xssh.PublicKey, net.Listener) {
+	signer, err := xssh.NewSignerFromKey(mustKey(t))
+	if err != nil {
+		t.Fatalf("NewSignerFromKey()=%s", err)
+	}
+
+	offered := make(chan xssh.PublicKey, 16)
+
+	cfg := &xssh.ServerConfig{
+		PublicKeyCallback: func(_ xssh.ConnMetadata, key xssh.PublicKey) (*xssh.Permissions, error) {
+			offered <- key
+			return nil, errors.New("denied")
+		},
+	}
+	cfg.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen()=%s", err)
+	}
+
+	go func() {
+		for {
+			nc, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			_, _, _, _ = xssh.NewServerConn(nc, cfg)
+			nc.Close()
+			offered <- nil
+		}
+	}()
+
+	return offered, l
+}
+
+func mustKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey()=%s", err)
+	}
+	return key
+}
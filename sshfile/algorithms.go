@@ -0,0 +1,73 @@
+package sshfile
+
+import (
+	"strings"
+
+	xssh "golang.org/x/crypto/ssh"
+)
+
+var defaultAlgorithms = func() xssh.Config {
+	var cfg xssh.Config
+	cfg.SetDefaults()
+	return cfg
+}()
+
+var defaultHostKeyAlgorithms = []string{
+	xssh.CertAlgoRSAv01, xssh.CertAlgoDSAv01, xssh.CertAlgoECDSA256v01,
+	xssh.CertAlgoECDSA384v01, xssh.CertAlgoECDSA521v01, xssh.CertAlgoED25519v01,
+
+	xssh.KeyAlgoECDSA256, xssh.KeyAlgoECDSA384, xssh.KeyAlgoECDSA521,
+	xssh.KeyAlgoRSA, xssh.KeyAlgoDSA,
+
+	xssh.KeyAlgoED25519,
+}
+
+// algorithms evaluates algorithm list as specified for Ciphers, MACs,
+// KexAlgorithms and HostKeyAlgorithms keywords, where a leading '+'
+// appends to the defaults, '-' removes matching patterns from them and
+// '^' moves the algorithms to the head of the list.
+func algorithms(spec string, defaults []string) []string {
+	if spec == "" {
+		return nil
+	}
+
+	list := strings.Split(spec[1:], ",")
+
+	switch spec[0] {
+	case '+':
+		return appendUnique(append([]string(nil), defaults...), list...)
+	case '-':
+		var algs []string
+	loop:
+		for _, alg := range defaults {
+			for _, pattern := range list {
+				if matchPattern(pattern, alg) {
+					continue loop
+				}
+			}
+			algs = append(algs, alg)
+		}
+		return algs
+	case '^':
+		return appendUnique(list, defaults...)
+	default:
+		return strings.Split(spec, ",")
+	}
+}
+
+func appendUnique(s []string, t ...string) []string {
+	seen := make(map[string]struct{}, len(s))
+
+	for _, s := range s {
+		seen[s] = struct{}{}
+	}
+
+	for _, t := range t {
+		if _, ok := seen[t]; !ok {
+			seen[t] = struct{}{}
+			s = append(s, t)
+		}
+	}
+
+	return s
+}
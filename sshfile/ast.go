@@ -0,0 +1,367 @@
+package sshfile
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// File is a syntax tree of an ssh_config file, which preserves comments,
+// ordering, indentation and separators of the parsed content, so the file
+// can be edited programmatically and written back without touching
+// unrelated lines.
+type File struct {
+	Global *Block
+	Blocks []*Block
+
+	eol     string
+	lastEOL bool
+}
+
+// Block is either the global section of a file or a Host or Match
+// block together with its header line.
+type Block struct {
+	Header *Line
+	Lines  []*Line
+}
+
+// Line is a single line of a file. Raw holds the original content, which
+// is written back verbatim unless the line was modified.
+type Line struct {
+	Raw     string
+	Indent  string
+	Keyword string
+	Sep     string
+	Value   string
+	Comment string
+
+	eol string
+}
+
+func ParseFile(r io.Reader) (*File, error) {
+	p, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{
+		Global:  new(Block),
+		eol:     "\n",
+		lastEOL: len(p) == 0 || bytes.HasSuffix(p, []byte("\n")),
+	}
+
+	if bytes.Contains(p, []byte("\r\n")) {
+		f.eol = "\r\n"
+	}
+
+	block := f.Global
+	s := string(p)
+
+	if f.lastEOL {
+		s = strings.TrimSuffix(s, "\n")
+	}
+
+	if len(p) == 0 {
+		return f, nil
+	}
+
+	for _, raw := range strings.Split(s, "\n") {
+		l := parseLine(strings.TrimSuffix(raw, "\r"))
+
+		if strings.HasSuffix(raw, "\r") {
+			l.eol = "\r\n"
+		}
+
+		if l.isBlock() {
+			block = &Block{Header: l}
+			f.Blocks = append(f.Blocks, block)
+			continue
+		}
+
+		block.Lines = append(block.Lines, l)
+	}
+
+	return f, nil
+}
+
+func parseLine(raw string) *Line {
+	l := &Line{Raw: raw}
+
+	ts := strings.TrimLeft(raw, " \t")
+	l.Indent = raw[:len(raw)-len(ts)]
+	ts = strings.TrimRight(ts, " \t")
+
+	if ts == "" || strings.HasPrefix(ts, "#") {
+		l.Comment = ts
+		return l
+	}
+
+	i := strings.IndexAny(ts, " \t=")
+	if i == -1 {
+		l.Keyword = ts
+		return l
+	}
+
+	l.Keyword = ts[:i]
+	rest := ts[i:]
+
+	j := 0
+	for eq := false; j < len(rest); j++ {
+		if rest[j] == '=' && !eq {
+			eq = true
+			continue
+		}
+		if rest[j] != ' ' && rest[j] != '\t' {
+			break
+		}
+	}
+
+	l.Sep, l.Value = rest[:j], rest[j:]
+
+	return l
+}
+
+func (l *Line) isBlock() bool {
+	return strings.EqualFold(l.Keyword, "Host") || strings.EqualFold(l.Keyword, "Match")
+}
+
+// IsComment reports whether the line is a comment or a blank line.
+func (l *Line) IsComment() bool {
+	return l.Keyword == ""
+}
+
+func (l *Line) String() string {
+	if l.Raw != "" || (l.Keyword == "" && l.Comment == "") {
+		return l.Raw
+	}
+	if l.Keyword == "" {
+		return l.Indent + l.Comment
+	}
+	return l.Indent + l.Keyword + l.Sep + l.Value
+}
+
+func (l *Line) set(value string) {
+	if l.Sep == "" {
+		l.Sep = " "
+	}
+	l.Value, l.Raw = value, ""
+}
+
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+
+	var (
+		n     int64
+		lines = f.lines()
+	)
+
+	for i, l := range lines {
+		m, _ := bw.WriteString(l.String())
+		n += int64(m)
+
+		if i != len(lines)-1 || f.lastEOL {
+			eol := l.eol
+			if eol == "" {
+				eol = f.eol
+			}
+
+			m, _ = bw.WriteString(eol)
+			n += int64(m)
+		}
+	}
+
+	return n, bw.Flush()
+}
+
+func (f *File) Bytes() []byte {
+	var buf bytes.Buffer
+	_, _ = f.WriteTo(&buf)
+	return buf.Bytes()
+}
+
+// Configs parses the file content into configs.
+func (f *File) Configs() (Configs, error) {
+	return ParseConfig(bytes.NewReader(f.Bytes()))
+}
+
+func (f *File) lines() []*Line {
+	lines := append([]*Line(nil), f.Global.Lines...)
+	for _, b := range f.Blocks {
+		lines = append(lines, b.Header)
+		lines = append(lines, b.Lines...)
+	}
+	return lines
+}
+
+// Host returns the Host block with the given patterns, or nil if the file
+// does not contain one.
+func (f *File) Host(patterns string) *Block {
+	return f.block("Host", patterns)
+}
+
+// Match returns the Match block with the given criteria, or nil if the
+// file does not contain one.
+func (f *File) Match(criteria string) *Block {
+	return f.block("Match", criteria)
+}
+
+func (f *File) block(keyword, value string) *Block {
+	for _, b := range f.Blocks {
+		if strings.EqualFold(b.Header.Keyword, keyword) && equalFields(b.Header.Value, value) {
+			return b
+		}
+	}
+	return nil
+}
+
+// AddHost returns the Host block with the given patterns, appending a new
+// one if the file does not contain it yet. New blocks are inserted before
+// a trailing "Host *" block, so they are not shadowed by it.
+func (f *File) AddHost(patterns string) *Block {
+	if b := f.Host(patterns); b != nil {
+		return b
+	}
+
+	b := &Block{
+		Header: &Line{Keyword: "Host", Sep: " ", Value: patterns},
+	}
+
+	i := len(f.Blocks)
+	if i != 0 && f.Blocks[i-1].Header.Value == "*" {
+		i--
+	}
+
+	if prev := f.prev(i); prev != nil && len(prev.Lines) != 0 && !prev.Lines[len(prev.Lines)-1].isBlank() {
+		prev.Lines = append(prev.Lines, &Line{})
+	}
+
+	if i != len(f.Blocks) {
+		b.Lines = append(b.Lines, &Line{})
+	}
+
+	f.Blocks = append(f.Blocks[:i], append([]*Block{b}, f.Blocks[i:]...)...)
+
+	return b
+}
+
+func (f *File) prev(i int) *Block {
+	if i == 0 {
+		if len(f.Global.Lines) == 0 {
+			return nil
+		}
+		return f.Global
+	}
+	return f.Blocks[i-1]
+}
+
+// RemoveHost removes the Host block with the given patterns and reports
+// whether it was found.
+func (f *File) RemoveHost(patterns string) bool {
+	for i, b := range f.Blocks {
+		if strings.EqualFold(b.Header.Keyword, "Host") && equalFields(b.Header.Value, patterns) {
+			f.Blocks = append(f.Blocks[:i], f.Blocks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the value of the first occurrence of the keyword.
+func (b *Block) Get(keyword string) (string, bool) {
+	for _, l := range b.Lines {
+		if strings.EqualFold(l.Keyword, keyword) {
+			return l.Value, true
+		}
+	}
+	return "", false
+}
+
+// Set updates the value of the first occurrence of the keyword in place,
+// or adds the keyword to the block if it is not set.
+func (b *Block) Set(keyword, value string) {
+	for _, l := range b.Lines {
+		if strings.EqualFold(l.Keyword, keyword) {
+			l.set(value)
+			return
+		}
+	}
+	b.Add(keyword, value)
+}
+
+// Add appends the keyword after its last occurrence, or after the last
+// keyword of the block, even if the keyword is already set, as is needed
+// by cumulative keywords like IdentityFile.
+func (b *Block) Add(keyword, value string) {
+	l := &Line{
+		Indent:  b.indent(),
+		Keyword: keyword,
+		Sep:     b.sep(),
+		Value:   value,
+	}
+
+	i := len(b.Lines)
+	for i > 0 && b.Lines[i-1].IsComment() {
+		i--
+	}
+
+	for j := len(b.Lines) - 1; j >= 0; j-- {
+		if strings.EqualFold(b.Lines[j].Keyword, keyword) {
+			i, l.Indent, l.Sep = j+1, b.Lines[j].Indent, b.Lines[j].Sep
+			break
+		}
+	}
+
+	b.Lines = append(b.Lines[:i], append([]*Line{l}, b.Lines[i:]...)...)
+}
+
+// Delete removes all occurrences of the keyword and reports whether any
+// was found.
+func (b *Block) Delete(keyword string) bool {
+	var (
+		lines []*Line
+		found bool
+	)
+
+	for _, l := range b.Lines {
+		if strings.EqualFold(l.Keyword, keyword) {
+			found = true
+			continue
+		}
+		lines = append(lines, l)
+	}
+
+	b.Lines = lines
+
+	return found
+}
+
+func (b *Block) indent() string {
+	for _, l := range b.Lines {
+		if !l.IsComment() {
+			return l.Indent
+		}
+	}
+	if b.Header != nil {
+		return "\t"
+	}
+	return ""
+}
+
+func (b *Block) sep() string {
+	for _, l := range b.Lines {
+		if !l.IsComment() && l.Sep != "" {
+			return l.Sep
+		}
+	}
+	return " "
+}
+
+func (l *Line) isBlank() bool {
+	return l.Keyword == "" && l.Comment == ""
+}
+
+func equalFields(s, t string) bool {
+	return strings.Join(strings.Fields(s), " ") == strings.Join(strings.Fields(t), " ")
+}
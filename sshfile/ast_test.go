@@ -0,0 +1,102 @@
+package sshfile_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/glaucusio/ssh/sshfile"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseFileRoundTrip(t *testing.T) {
+	p, err := ioutil.ReadFile("testdata/config")
+	if err != nil {
+		t.Fatalf("ReadFile()=%s", err)
+	}
+
+	for _, want := range []string{
+		string(p),
+		"",
+		"# only a comment",
+		"User foo\r\n\r\nHost bar   # trailing\r\n  Port=22  \r\n",
+	} {
+		f, err := sshfile.ParseFile(strings.NewReader(want))
+		if err != nil {
+			t.Fatalf("ParseFile()=%s", err)
+		}
+
+		if got := string(f.Bytes()); got != want {
+			t.Fatalf("got != want:\n%s\n", cmp.Diff(got, want))
+		}
+	}
+}
+
+func TestFileEdit(t *testing.T) {
+	const config = `# managed by hand
+User admin
+
+Host bastion
+    # the jump host
+    Hostname=10.0.0.1
+    IdentityFile ~/.ssh/id_bastion
+
+Host old
+	User nobody
+
+Host *
+	ServerAliveInterval 60
+`
+
+	const want = `# managed by hand
+User admin
+
+Host bastion
+    # the jump host
+    Hostname=10.0.0.2
+    IdentityFile ~/.ssh/id_bastion
+    IdentityFile ~/.ssh/id_backup
+    Port=2222
+
+Host web
+	ProxyJump bastion
+
+Host *
+	ServerAliveInterval 60
+`
+
+	f, err := sshfile.ParseFile(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("ParseFile()=%s", err)
+	}
+
+	bastion := f.Host("bastion")
+	if bastion == nil {
+		t.Fatal("Host(bastion)=nil")
+	}
+
+	bastion.Set("HostName", "10.0.0.2")
+	bastion.Add("IdentityFile", "~/.ssh/id_backup")
+	bastion.Set("Port", "2222")
+
+	if !f.RemoveHost("old") {
+		t.Fatal("RemoveHost(old)=false")
+	}
+
+	f.AddHost("web").Set("ProxyJump", "bastion")
+
+	var buf bytes.Buffer
+
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo()=%s", err)
+	}
+
+	if got := buf.String(); got != want {
+		t.Fatalf("got != want:\n%s\n", cmp.Diff(got, want))
+	}
+
+	if _, err := f.Configs(); err != nil {
+		t.Fatalf("Configs()=%s", err)
+	}
+}
@@ -1,6 +1,7 @@
 package sshfile
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -12,8 +13,85 @@ import (
 var NoAuthMethods = errors.New("no auth methods could be used")
 
 func IdentityAuth(files ...string) (ssh.AuthMethod, error) {
+	signers, err := identitySigners(files...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ssh.PublicKeys(signers...), nil
+}
+
+// publicKeys returns public key auth with the identity files and the agent,
+// or nil if there are neither. An agent set with IdentityAgent that can not
+// be connected to is an error, while the SSH_AUTH_SOCK one is skipped.
+func (c *Config) publicKeys() (ssh.AuthMethod, error) {
+	socket, explicit := c.agentSocket()
+
+	if socket != "" && explicit {
+		if err := checkAgent(socket); err != nil {
+			return nil, fmt.Errorf("failed to build agent auth: %w", err)
+		}
+	}
+
+	if socket == "" {
+		if len(c.IdentityFile) == 0 {
+			return nil, nil
+		}
+
+		signers, err := identitySigners(c.IdentityFile...)
+		if errors.Is(err, NoAuthMethods) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to build identity auth: %w", err)
+		}
+
+		certs, err := certificateSigners(signers, c.CertificateFile...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build certificate auth: %w", err)
+		}
+
+		return ssh.PublicKeys(append(certs, signers...)...), nil
+	}
+
+	ids := loadIdentities(c.IdentityFile...)
+
+	var signers []ssh.Signer
+	for _, id := range ids {
+		if id.signer != nil {
+			signers = append(signers, id.signer)
+		}
+	}
+
+	certs, err := certificateSigners(signers, c.CertificateFile...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build certificate auth: %w", err)
+	}
+
+	return ssh.PublicKeysCallback(agentSigners(socket, c.IdentitiesOnly.Bool(), certs, ids)), nil
+}
+
+// identitySigners returns the signers of the identity files, skipping
+// the ones loadIdentities skips and the encrypted ones.
+func identitySigners(files ...string) ([]ssh.Signer, error) {
 	var signers []ssh.Signer
 
+	for _, id := range loadIdentities(files...) {
+		if id.signer != nil {
+			signers = append(signers, id.signer)
+		}
+	}
+
+	if len(signers) == 0 {
+		return nil, NoAuthMethods
+	}
+
+	return signers, nil
+}
+
+func certificateSigners(signers []ssh.Signer, files ...string) ([]ssh.Signer, error) {
+	var certs []ssh.Signer
+
 	for _, file := range files {
 		p, err := ioutil.ReadFile(file)
 		if os.IsNotExist(err) && len(files) != 1 {
@@ -23,17 +101,27 @@ func IdentityAuth(files ...string) (ssh.AuthMethod, error) {
 			return nil, fmt.Errorf("error reading %q file: %w", file, err)
 		}
 
-		signer, err := ssh.ParsePrivateKey(p)
+		key, _, _, _, err := ssh.ParseAuthorizedKey(p)
 		if err != nil {
 			return nil, fmt.Errorf("error parsing %q file: %w", file, err)
 		}
 
-		signers = append(signers, signer)
-	}
+		cert, ok := key.(*ssh.Certificate)
+		if !ok {
+			return nil, fmt.Errorf("%q file is not a certificate", file)
+		}
 
-	if len(signers) == 0 {
-		return nil, NoAuthMethods
+		for _, signer := range signers {
+			if bytes.Equal(signer.PublicKey().Marshal(), cert.Key.Marshal()) {
+				cs, err := ssh.NewCertSigner(cert, signer)
+				if err != nil {
+					return nil, fmt.Errorf("error creating signer for %q file: %w", file, err)
+				}
+
+				certs = append(certs, cs)
+			}
+		}
 	}
 
-	return ssh.PublicKeys(signers...), nil
+	return certs, nil
 }
@@ -0,0 +1,105 @@
+package sshfile
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
+}
+
+var _ Resolver = net.DefaultResolver
+
+type contextKey struct{ string }
+
+var resolverKey = contextKey{"resolver"}
+
+func ContextResolver(ctx context.Context) Resolver {
+	if r, ok := ctx.Value(resolverKey).(Resolver); ok {
+		return r
+	}
+	return net.DefaultResolver
+}
+
+func WithResolver(ctx context.Context, r Resolver) context.Context {
+	return context.WithValue(ctx, resolverKey, r)
+}
+
+// canonicalize implements the CanonicalizeHostname, CanonicalDomains,
+// CanonicalizeFallbackLocal, CanonicalizeMaxDots and
+// CanonicalizePermittedCNAMEs keywords. It reports whether the returned
+// host was canonicalized.
+func (c *Config) canonicalize(ctx context.Context, host string) (string, bool, error) {
+	switch strings.ToLower(c.CanonicalizeHostname) {
+	case "always":
+	case "yes":
+		if (c.ProxyCommand != "" && !strings.EqualFold(c.ProxyCommand, "none")) ||
+			(c.ProxyJump != "" && !strings.EqualFold(c.ProxyJump, "none")) {
+			return host, false, nil
+		}
+	default:
+		return host, false, nil
+	}
+
+	if strings.HasSuffix(host, ".") {
+		return strings.TrimSuffix(host, "."), true, nil
+	}
+
+	if net.ParseIP(host) != nil {
+		return host, false, nil
+	}
+
+	maxDots := 1
+	if c.CanonicalizeMaxDots != nil {
+		maxDots = *c.CanonicalizeMaxDots
+	}
+
+	if strings.Count(host, ".") > maxDots {
+		return host, false, nil
+	}
+
+	r := ContextResolver(ctx)
+
+	for _, domain := range strings.Fields(c.CanonicalDomains) {
+		fqdn := host + "." + strings.TrimSuffix(domain, ".")
+
+		if _, err := r.LookupHost(ctx, fqdn); err != nil {
+			continue
+		}
+
+		if cname, err := r.LookupCNAME(ctx, fqdn); err == nil {
+			if cname = strings.TrimSuffix(cname, "."); cname != fqdn && c.permittedCNAME(fqdn, cname) {
+				return cname, true, nil
+			}
+		}
+
+		return fqdn, true, nil
+	}
+
+	if c.CanonicalizeFallbackLocal == nil || c.CanonicalizeFallbackLocal.Bool() {
+		return host, false, nil
+	}
+
+	return "", false, fmt.Errorf("failed to canonicalize %q hostname", host)
+}
+
+func (c *Config) permittedCNAME(source, target string) bool {
+	source, target = strings.ToLower(source), strings.ToLower(target)
+
+	for _, rule := range strings.Fields(c.CanonicalizePermittedCNAMEs) {
+		i := strings.IndexRune(rule, ':')
+		if i == -1 {
+			continue
+		}
+
+		if matchList(strings.ToLower(rule[:i]), source) && matchList(strings.ToLower(rule[i+1:]), target) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,157 @@
+package sshfile_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/glaucusio/ssh/sshfile"
+)
+
+type fakeResolver struct {
+	hosts  map[string][]string
+	cnames map[string]string
+}
+
+func (r fakeResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	if addrs, ok := r.hosts[host]; ok {
+		return addrs, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func (r fakeResolver) LookupCNAME(_ context.Context, host string) (string, error) {
+	if cname, ok := r.cnames[host]; ok {
+		return cname, nil
+	}
+	return host + ".", nil
+}
+
+func TestCanonicalize(t *testing.T) {
+	const config = `CanonicalizeHostname yes
+CanonicalDomains dev.example.com example.com
+CanonicalizePermittedCNAMEs *.example.com:*.cdn.example.net
+
+Host *.dev.example.com
+	User developer
+
+Match canonical host *.cdn.example.net
+	User cdn
+
+Host strict
+	CanonicalizeHostname yes
+	CanonicalDomains example.org
+	CanonicalizeFallbackLocal no
+
+Host proxied
+	ProxyJump bastion
+
+Host api.v2
+	CanonicalizeMaxDots 0
+
+Host *
+	User nobody
+`
+
+	cfgs, err := sshfile.ParseConfig(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("ParseConfig()=%s", err)
+	}
+
+	ctx := sshfile.WithResolver(context.Background(), fakeResolver{
+		hosts: map[string][]string{
+			"web.dev.example.com":    {"10.0.0.1"},
+			"static.example.com":     {"10.0.0.2"},
+			"proxied.example.com":    {"10.0.0.3"},
+			"api.v2.dev.example.com": {"10.0.0.4"},
+		},
+		cnames: map[string]string{
+			"static.example.com": "edge1.cdn.example.net.",
+		},
+	})
+
+	cases := []struct {
+		host     string
+		hostname string
+		user     string
+	}{
+		{"web", "web.dev.example.com", "developer"},
+		{"static", "edge1.cdn.example.net", "cdn"},
+		{"db", "", "nobody"},
+		{"a.b.c", "", "nobody"},
+		{"10.0.0.1", "", "nobody"},
+		{"proxied", "", "nobody"},
+		{"api.v2", "", "nobody"},
+	}
+
+	for _, cas := range cases {
+		t.Run(cas.host, func(t *testing.T) {
+			got, err := cfgs.Lookup(ctx, cas.host)
+			if err != nil {
+				t.Fatalf("Lookup()=%s", err)
+			}
+
+			if got.Hostname != cas.hostname {
+				t.Errorf("Hostname=%q, want %q", got.Hostname, cas.hostname)
+			}
+
+			if got.User != cas.user {
+				t.Errorf("User=%q, want %q", got.User, cas.user)
+			}
+		})
+	}
+
+	if _, err := cfgs.Lookup(ctx, "strict"); err == nil {
+		t.Fatal("Lookup(strict): expected error")
+	}
+}
+
+func TestCanonicalizeExpandedHostname(t *testing.T) {
+	const config = `CanonicalizeHostname yes
+CanonicalDomains example.com
+
+Host web
+	Hostname %h.internal
+
+Host pct
+	Hostname pct%%1
+
+Host lit
+	Hostname lit%%
+`
+
+	cfgs, err := sshfile.ParseConfig(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("ParseConfig()=%s", err)
+	}
+
+	ctx := sshfile.WithResolver(context.Background(), fakeResolver{
+		hosts: map[string][]string{
+			"web.example.com":          {"10.0.0.1"},
+			"web.internal.example.com": {"10.0.0.2"},
+			"pct.example.com":          {"10.0.0.3"},
+			"pct%1.example.com":        {"10.0.0.4"},
+		},
+	})
+
+	// The hostname is expanded once and then canonicalized, like ssh does.
+	for host, want := range map[string]string{
+		"web": "web.internal.example.com",
+		"pct": "pct%1.example.com",
+		"lit": "lit%",
+	} {
+		cfg, err := cfgs.Lookup(ctx, host)
+		if err != nil {
+			t.Fatalf("Lookup(%q)=%s", host, err)
+		}
+
+		if cfg, err = cfg.Expand(host); err != nil {
+			t.Fatalf("Expand(%q)=%s", host, err)
+		}
+
+		if cfg.Hostname != want {
+			t.Errorf("%s: Hostname=%q, want %q", host, cfg.Hostname, want)
+		}
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"io"
 	"net"
 	"os"
+	"os/user"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -17,31 +19,137 @@ import (
 	"github.com/glaucusio/ssh/sshutil"
 
 	xssh "golang.org/x/crypto/ssh"
-	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 var globalHost = Host{
 	Regexp: regexp.MustCompile(".*"),
 }
 
+// allHosts matches every host like globalHost does, but in the place of
+// the config it belongs to, like a Host * block.
+var allHosts = Host{
+	Regexp: regexp.MustCompile("(?i)^.*$"),
+}
+
 type Config struct {
-	Port                  int      `json:"port,string,omitempty"`
-	StrictHostKeyChecking *Bool    `json:"stricthostkeychecking,omitempty"`
-	GlobalKnownHostsFile  string   `json:"globalknownhostsfile,omitempty"`
-	UserKnownHostsFile    string   `json:"userknownhostsfile,omitempty"`
-	TcpKeepAlive          *Bool    `json:"tcpkeepalive,omitempty"`
-	ConnectTimeout        Duration `json:"connecttimeout,omitempty"`
-	ConnectionAttempts    int      `json:"connectionattempts,string,omitempty"`
-	ServerAliveInterval   Duration `json:"serveraliveinterval,omitempty"`
-	ServerAliveCountMax   int      `json:"serveralivecountmax,string,omitempty"`
-	Hostname              string   `json:"hostname,omitempty"`
-	User                  string   `json:"user,omitempty"`
-	IdentityFile          string   `json:"identityfile,omitempty"`
-	Host                  Host     `json:"host,omitempty"`
+	Port                             int             `json:"port,string,omitempty"`
+	StrictHostKeyChecking            HostKeyChecking `json:"stricthostkeychecking,omitempty"`
+	GlobalKnownHostsFile             Strings         `json:"globalknownhostsfile,omitempty"`
+	UserKnownHostsFile               Strings         `json:"userknownhostsfile,omitempty"`
+	TcpKeepAlive                     *Bool           `json:"tcpkeepalive,omitempty"`
+	ConnectTimeout                   Duration        `json:"connecttimeout,omitempty"`
+	ConnectionAttempts               int             `json:"connectionattempts,string,omitempty"`
+	ServerAliveInterval              Duration        `json:"serveraliveinterval,omitempty"`
+	ServerAliveCountMax              int             `json:"serveralivecountmax,string,omitempty"`
+	Hostname                         string          `json:"hostname,omitempty"`
+	User                             string          `json:"user,omitempty"`
+	IdentityFile                     Strings         `json:"identityfile,omitempty"`
+	AddKeysToAgent                   string          `json:"addkeystoagent,omitempty"`
+	AddressFamily                    string          `json:"addressfamily,omitempty"`
+	BatchMode                        *Bool           `json:"batchmode,omitempty"`
+	BindAddress                      string          `json:"bindaddress,omitempty"`
+	BindInterface                    string          `json:"bindinterface,omitempty"`
+	CanonicalDomains                 string          `json:"canonicaldomains,omitempty"`
+	CanonicalizeFallbackLocal        *Bool           `json:"canonicalizefallbacklocal,omitempty"`
+	CanonicalizeHostname             string          `json:"canonicalizehostname,omitempty"`
+	CanonicalizeMaxDots              *int            `json:"canonicalizemaxdots,string,omitempty"`
+	CanonicalizePermittedCNAMEs      string          `json:"canonicalizepermittedcnames,omitempty"`
+	CASignatureAlgorithms            string          `json:"casignaturealgorithms,omitempty"`
+	CertificateFile                  Strings         `json:"certificatefile,omitempty"`
+	ChannelTimeout                   string          `json:"channeltimeout,omitempty"`
+	CheckHostIP                      *Bool           `json:"checkhostip,omitempty"`
+	Ciphers                          string          `json:"ciphers,omitempty"`
+	ClearAllForwardings              *Bool           `json:"clearallforwardings,omitempty"`
+	Compression                      *Bool           `json:"compression,omitempty"`
+	ControlMaster                    string          `json:"controlmaster,omitempty"`
+	ControlPath                      string          `json:"controlpath,omitempty"`
+	ControlPersist                   string          `json:"controlpersist,omitempty"`
+	DynamicForward                   string          `json:"dynamicforward,omitempty"`
+	EnableEscapeCommandline          *Bool           `json:"enableescapecommandline,omitempty"`
+	EnableSSHKeysign                 *Bool           `json:"enablesshkeysign,omitempty"`
+	EscapeChar                       string          `json:"escapechar,omitempty"`
+	ExitOnForwardFailure             *Bool           `json:"exitonforwardfailure,omitempty"`
+	FingerprintHash                  string          `json:"fingerprinthash,omitempty"`
+	ForkAfterAuthentication          *Bool           `json:"forkafterauthentication,omitempty"`
+	ForwardAgent                     string          `json:"forwardagent,omitempty"`
+	ForwardX11                       *Bool           `json:"forwardx11,omitempty"`
+	ForwardX11Timeout                Duration        `json:"forwardx11timeout,omitempty"`
+	ForwardX11Trusted                *Bool           `json:"forwardx11trusted,omitempty"`
+	GatewayPorts                     *Bool           `json:"gatewayports,omitempty"`
+	GSSAPIAuthentication             *Bool           `json:"gssapiauthentication,omitempty"`
+	GSSAPIDelegateCredentials        *Bool           `json:"gssapidelegatecredentials,omitempty"`
+	HashKnownHosts                   *Bool           `json:"hashknownhosts,omitempty"`
+	HostbasedAcceptedAlgorithms      string          `json:"hostbasedacceptedalgorithms,omitempty"`
+	HostbasedAuthentication          *Bool           `json:"hostbasedauthentication,omitempty"`
+	HostKeyAlgorithms                string          `json:"hostkeyalgorithms,omitempty"`
+	HostKeyAlias                     string          `json:"hostkeyalias,omitempty"`
+	IdentitiesOnly                   *Bool           `json:"identitiesonly,omitempty"`
+	IdentityAgent                    string          `json:"identityagent,omitempty"`
+	IgnoreUnknown                    string          `json:"ignoreunknown,omitempty"`
+	IPQoS                            string          `json:"ipqos,omitempty"`
+	KbdInteractiveAuthentication     *Bool           `json:"kbdinteractiveauthentication,omitempty"`
+	KbdInteractiveDevices            string          `json:"kbdinteractivedevices,omitempty"`
+	KexAlgorithms                    string          `json:"kexalgorithms,omitempty"`
+	KnownHostsCommand                string          `json:"knownhostscommand,omitempty"`
+	LocalCommand                     string          `json:"localcommand,omitempty"`
+	LocalForward                     string          `json:"localforward,omitempty"`
+	LogLevel                         string          `json:"loglevel,omitempty"`
+	LogVerbose                       string          `json:"logverbose,omitempty"`
+	MACs                             string          `json:"macs,omitempty"`
+	NoHostAuthenticationForLocalhost *Bool           `json:"nohostauthenticationforlocalhost,omitempty"`
+	NumberOfPasswordPrompts          int             `json:"numberofpasswordprompts,string,omitempty"`
+	ObscureKeystrokeTiming           string          `json:"obscurekeystroketiming,omitempty"`
+	PasswordAuthentication           *Bool           `json:"passwordauthentication,omitempty"`
+	PermitLocalCommand               *Bool           `json:"permitlocalcommand,omitempty"`
+	PermitRemoteOpen                 string          `json:"permitremoteopen,omitempty"`
+	PKCS11Provider                   string          `json:"pkcs11provider,omitempty"`
+	PreferredAuthentications         string          `json:"preferredauthentications,omitempty"`
+	ProxyCommand                     string          `json:"proxycommand,omitempty"`
+	ProxyJump                        string          `json:"proxyjump,omitempty"`
+	ProxyUseFdpass                   *Bool           `json:"proxyusefdpass,omitempty"`
+	PubkeyAcceptedAlgorithms         string          `json:"pubkeyacceptedalgorithms,omitempty"`
+	PubkeyAuthentication             string          `json:"pubkeyauthentication,omitempty"`
+	RekeyLimit                       *RekeyLimit     `json:"rekeylimit,omitempty"`
+	RemoteCommand                    string          `json:"remotecommand,omitempty"`
+	RemoteForward                    string          `json:"remoteforward,omitempty"`
+	RequestTTY                       string          `json:"requesttty,omitempty"`
+	RequiredRSASize                  int             `json:"requiredrsasize,string,omitempty"`
+	RevokedHostKeys                  string          `json:"revokedhostkeys,omitempty"`
+	SecurityKeyProvider              string          `json:"securitykeyprovider,omitempty"`
+	SendEnv                          string          `json:"sendenv,omitempty"`
+	SessionType                      string          `json:"sessiontype,omitempty"`
+	SetEnv                           string          `json:"setenv,omitempty"`
+	StdinNull                        *Bool           `json:"stdinnull,omitempty"`
+	StreamLocalBindMask              string          `json:"streamlocalbindmask,omitempty"`
+	StreamLocalBindUnlink            *Bool           `json:"streamlocalbindunlink,omitempty"`
+	SyslogFacility                   string          `json:"syslogfacility,omitempty"`
+	Tag                              string          `json:"tag,omitempty"`
+	Tunnel                           string          `json:"tunnel,omitempty"`
+	TunnelDevice                     string          `json:"tunneldevice,omitempty"`
+	UpdateHostKeys                   Ask             `json:"updatehostkeys,omitempty"`
+	VerifyHostKeyDNS                 Ask             `json:"verifyhostkeydns,omitempty"`
+	VisualHostKey                    *Bool           `json:"visualhostkey,omitempty"`
+	XAuthLocation                    string          `json:"xauthlocation,omitempty"`
+	Match                            Match           `json:"match,omitempty"`
+	Host                             Host            `json:"host,omitempty"`
+	Origins                          Origins         `json:"origins,omitempty"`
 }
 
 func (c *Config) Merge(in *Config) error {
-	return merge(c, in)
+	identity, certs, host, match := c.IdentityFile, c.CertificateFile, c.Host, c.Match
+
+	if err := merge(c, in); err != nil {
+		return err
+	}
+
+	c.IdentityFile = appendUnique(in.IdentityFile.clone(), identity...)
+	c.CertificateFile = appendUnique(in.CertificateFile.clone(), certs...)
+
+	if in.Host.Regexp == nil && len(in.Match) == 0 {
+		c.Host, c.Match = host, match
+	}
+
+	return nil
 }
 
 var _ = new(Config).clone()
@@ -60,7 +168,16 @@ func (c *Config) clone() *Config {
 	return &cCopy
 }
 
-func (c *Config) build() (*ssh.Config, error) {
+func (c *Config) build(host string) (*ssh.Config, error) {
+	c, err := c.Expand(host)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Hostname == "" {
+		c.Hostname = host
+	}
+
 	cfg := &ssh.Config{
 		ClientConfig: xssh.ClientConfig{
 			User:    c.User,
@@ -79,34 +196,52 @@ func (c *Config) build() (*ssh.Config, error) {
 		cfg.KeepAlive = c.TcpKeepAlive.Bool()
 	}
 
-	if c.StrictHostKeyChecking == nil || c.StrictHostKeyChecking.Bool() {
-		if files := nonempty(c.GlobalKnownHostsFile, c.UserKnownHostsFile); len(files) != 0 {
-			known, err := knownhosts.New(files...)
-			if err != nil {
-				return nil, fmt.Errorf("failed to build known hosts list: %w", err)
-			}
-
-			cfg.HostKeyCallback = known
+	if c.StrictHostKeyChecking != HostKeyCheckingNo {
+		known, err := c.knownHosts()
+		if err != nil {
+			return nil, fmt.Errorf("failed to build known hosts list: %w", err)
 		}
+
+		cfg.HostKeyCallback = known
 	} else {
 		cfg.HostKeyCallback = xssh.InsecureIgnoreHostKey()
 	}
 
+	if c.RekeyLimit != nil && c.RekeyLimit.Data != 0 {
+		cfg.RekeyThreshold = uint64(c.RekeyLimit.Data)
+	}
+
+	port := "22"
 	if c.Port != 0 {
-		cfg.Address = net.JoinHostPort(cfg.Address, strconv.Itoa(c.Port))
-	} else {
-		cfg.Address = net.JoinHostPort(cfg.Address, "22")
+		port = strconv.Itoa(c.Port)
 	}
 
-	if c.IdentityFile != "" {
-		auth, err := IdentityAuth(c.IdentityFile)
-		if err != nil {
-			return nil, fmt.Errorf("failed to build identity auth: %w", err)
+	cfg.Address = net.JoinHostPort(cfg.Address, port)
+
+	if c.HostKeyAlias != "" && cfg.HostKeyCallback != nil {
+		alias, known := net.JoinHostPort(c.HostKeyAlias, port), cfg.HostKeyCallback
+
+		cfg.HostKeyCallback = func(_ string, remote net.Addr, key xssh.PublicKey) error {
+			return known(alias, remote, key)
 		}
+	}
+
+	cfg.Ciphers = algorithms(c.Ciphers, defaultAlgorithms.Ciphers)
+	cfg.MACs = algorithms(c.MACs, defaultAlgorithms.MACs)
+	cfg.KeyExchanges = algorithms(c.KexAlgorithms, defaultAlgorithms.KeyExchanges)
+	cfg.HostKeyAlgorithms = algorithms(c.HostKeyAlgorithms, defaultHostKeyAlgorithms)
+
+	auth, err := c.publicKeys()
+	if err != nil {
+		return nil, err
+	}
 
+	if auth != nil {
 		cfg.Auth = append(cfg.Auth, auth)
 	}
 
+	cfg.Jump = jumpHosts(c.ProxyJump)
+
 	// todo?
 
 	return cfg, nil
@@ -114,11 +249,11 @@ func (c *Config) build() (*ssh.Config, error) {
 
 func (c *Config) Callback() ssh.ConfigCallback {
 	return func(ctx context.Context, network, address string) (*ssh.Config, error) {
-		if !c.Host.MatchString(address) {
+		if !c.match(newMatchContext(ctx, address, c)) {
 			return nil, ssh.ErrConfigNotFound
 		}
 
-		cfg, err := c.build()
+		cfg, err := c.build(address)
 		if err != nil {
 			return nil, fmt.Errorf("failed to build config: %w", err)
 		}
@@ -127,6 +262,13 @@ func (c *Config) Callback() ssh.ConfigCallback {
 	}
 }
 
+func (c *Config) match(mc *matchContext) bool {
+	if len(c.Match) != 0 {
+		return c.Match.match(mc)
+	}
+	return c.Host.Regexp != nil && c.Host.MatchString(mc.host)
+}
+
 type Host struct {
 	*regexp.Regexp
 }
@@ -182,85 +324,318 @@ func (h Host) String() string {
 type Configs []*Config
 
 func (c Configs) Callback() ssh.ConfigCallback {
-	var callbacks []ssh.ConfigCallback
+	return func(ctx context.Context, network, address string) (*ssh.Config, error) {
+		d, err := ssh.ParseDestination(address)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg, err := c.lookup(ctx, d.Host)
+		if err != nil {
+			return nil, err
+		}
 
-	for _, c := range c.fat() {
-		callbacks = append(callbacks, c.Callback())
+		if dest := ssh.ContextDestination(ctx); dest != nil {
+			cfg.ApplyDestination(dest)
+		}
+
+		cfg.ApplyDestination(d)
+
+		sshcfg, err := cfg.build(d.Host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build config: %w", err)
+		}
+
+		return sshcfg, nil
 	}
+}
 
-	return sshutil.Callback(callbacks...)
+// ApplyDestination sets the user and the port given in the destination,
+// unless they were set with command line options, which take precedence.
+func (c *Config) ApplyDestination(d *ssh.Destination) {
+	if d.User != "" && !c.Origins.commandLine("user") {
+		c.User = d.User
+		c.Origins.merge(Origins{"user": {Source: "destination " + d.String()}})
+	}
+
+	if d.Port != 0 && !c.Origins.commandLine("port") {
+		c.Port = d.Port
+		c.Origins.merge(Origins{"port": {Source: "destination " + d.String()}})
+	}
 }
 
 func (c Configs) LazyCallback() ssh.ConfigCallback {
-	var fns []func() ssh.ConfigCallback
+	return sshutil.LazyCallback(c.Callback)
+}
+
+// Lookup returns the configuration that applies to the given host,
+// canonicalizing the host first if the configuration requests it.
+func (c Configs) Lookup(ctx context.Context, host string) (*Config, error) {
+	return c.lookup(ctx, host)
+}
+
+// Default returns the configs with d applied to every host for the
+// settings the host has not configured, like the built-in defaults of ssh.
+// Unlike the global settings, the identity files of d are used only by
+// the hosts without any configured.
+func (c Configs) Default(d *Config) Configs {
+	d = d.clone()
+	d.Host, d.Match = Host{}, nil
+
+	var configs Configs
 
-	for _, c := range c.fat() {
-		fns = append(fns, c.Callback)
+	for _, cfg := range c {
+		if !cfg.defaults() {
+			configs = append(configs, cfg)
+		}
 	}
 
-	return sshutil.LazyCallback(fns...)
+	return append(configs, d)
 }
 
-var _ = Configs(nil).Merge(nil)
+func (c Configs) lookup(ctx context.Context, host string) (*Config, error) {
+	cfg, err := c.lookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
 
-func (c Configs) Merge(in Configs) Configs {
-	var merged, global []*Config
+	for _, d := range c {
+		if !d.defaults() {
+			continue
+		}
 
-	for i := range c {
-		if c[i].Host.Equal(globalHost) {
-			global = append(global, c[i])
-		} else {
-			merged = append(merged, c[i])
+		d = d.clone()
+
+		if len(cfg.IdentityFile) != 0 {
+			d.IdentityFile = nil
+			delete(d.Origins, "identityfile")
 		}
+
+		if err := d.Merge(cfg); err != nil {
+			return nil, err
+		}
+
+		d.Host, d.Match = cfg.Host, cfg.Match
+		cfg = d
+	}
+
+	return cfg, nil
+}
+
+// defaults reports whether the config holds the defaults added with
+// Default, which is the only config matching no host.
+func (c *Config) defaults() bool {
+	return c.Host.Regexp == nil && len(c.Match) == 0
+}
+
+func (c Configs) lookupHost(ctx context.Context, host string) (*Config, error) {
+	mc := newMatchContext(ctx, host, c.global())
+
+	var err error
+
+	cfg := c.resolve(mc.match)
+	if cfg == nil {
+		return nil, ssh.ErrConfigNotFound
+	}
+
+	// Like ssh, canonicalize the hostname the host resolves to, expanding
+	// it once here; the canonical name replaces it, escaped so that it is
+	// kept as is when the config is expanded.
+	name := host
+	if cfg.Hostname != "" {
+		if name, err = expand(cfg.Hostname, tokens{'h': host}, tokensHostname, false); err != nil {
+			return nil, fmt.Errorf("failed to expand hostname: %w", err)
+		}
+	}
+
+	canonical, ok, err := cfg.canonicalize(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok && !c.final() {
+		return cfg, nil
 	}
 
-	for i := range in {
-		if in[i].Host.Equal(globalHost) {
-			global = append(global, in[i])
-		} else {
-			merged = append(merged, in[i])
+	mc.host, mc.canonical, mc.final = canonical, ok, true
+
+	if final := c.resolve(mc.match); final != nil {
+		cfg = final
+	}
+
+	if ok {
+		if cfg.Hostname == "" {
+			cfg.Origins.merge(Origins{"hostname": {Source: "canonicalization of " + host}})
 		}
+
+		cfg.Hostname = strings.Replace(canonical, "%", "%%", -1)
 	}
 
-	if len(global) != 0 {
-		g := global[0]
+	return cfg, nil
+}
+
+// resolve merges the configs for which match returns true like ssh does:
+// the first value obtained for every keyword is used, going through the
+// global settings and then the blocks in file order, while the identity
+// and certificate files accumulate. It returns nil if nothing matches.
+func (c Configs) resolve(match func(*Config) bool) *Config {
+	var (
+		cfg   *Config
+		block *Config
+	)
+
+	for _, global := range []bool{true, false} {
+		for _, e := range c {
+			if e.Host.Equal(globalHost) != global || !match(e) {
+				continue
+			}
+
+			if !global && block == nil {
+				block = e
+			}
+
+			if cfg == nil {
+				cfg = e.clone()
+				continue
+			}
+
+			e = e.clone()
 
-		for i := len(global) - 1; i > 1; i-- {
-			if err := g.Merge(global[i]); err != nil {
+			if err := e.Merge(cfg); err != nil {
 				panic("unexpected error: " + err.Error())
 			}
+
+			cfg = e
 		}
+	}
 
-		merged = append(merged, g)
+	if cfg != nil && block != nil {
+		cfg.Host, cfg.Match = block.Host, block.Match
 	}
 
-	return merged
+	return cfg
 }
 
-func (c Configs) fat() Configs {
-	c = c.clone()
+func (c Configs) global() *Config {
+	for i := len(c) - 1; i >= 0; i-- {
+		if c[i].Host.Equal(globalHost) {
+			return c[i]
+		}
+	}
+	return nil
+}
 
-	for i := len(c) - 1; i > 0; i-- {
-		g := c[i]
+// Check builds the config that applies to every host, reporting errors
+// in the files it names, like malformed known hosts files, which would
+// otherwise surface only when connecting.
+func (c Configs) Check() error {
+	g := c.resolve(func(cfg *Config) bool {
+		return cfg.Host.Equal(globalHost) || cfg.Host.Equal(allHosts)
+	})
+	if g == nil {
+		return nil
+	}
+
+	if _, err := g.build(""); err != nil {
+		return fmt.Errorf("failed to build global config: %w", err)
+	}
 
-		if !g.Host.Equal(globalHost) {
+	return nil
+}
+
+// Files returns the identity, certificate and known hosts files named in
+// the configs, with tilde prefixes, environment variables and tokens
+// expanded. Files whose names depend on the host are skipped.
+func (c Configs) Files() []string {
+	var files []string
+
+	for _, cfg := range c {
+		f := &Config{
+			IdentityFile:         hostless(cfg.IdentityFile),
+			CertificateFile:      hostless(cfg.CertificateFile),
+			UserKnownHostsFile:   hostless(cfg.UserKnownHostsFile),
+			GlobalKnownHostsFile: cfg.GlobalKnownHostsFile,
+		}
+
+		f, err := f.Expand("")
+		if err != nil {
 			continue
 		}
 
-		for i := range c {
-			g := g.clone()
+		files = appendUnique(files, f.IdentityFile...)
+		files = appendUnique(files, f.CertificateFile...)
+		files = appendUnique(files, f.UserKnownHostsFile...)
+		files = appendUnique(files, f.GlobalKnownHostsFile...)
+	}
 
-			if err := g.Merge(c[i]); err != nil {
-				panic("unexpected error: " + err.Error())
+	return files
+}
+
+// hostless returns the paths that do not use any of the tokens that
+// depend on the host.
+func hostless(paths Strings) Strings {
+	var list Strings
+
+loop:
+	for _, path := range paths {
+		for i := 0; i+1 < len(path); i++ {
+			if path[i] != '%' {
+				continue
+			}
+			if strings.IndexByte("Chjknpr", path[i+1]) != -1 {
+				continue loop
 			}
+			i++
+		}
+		list = append(list, path)
+	}
+
+	return list
+}
 
-			c[i] = g
+func (c Configs) final() bool {
+	for _, cfg := range c {
+		for _, crit := range cfg.Match {
+			if crit.Keyword == "final" {
+				return true
+			}
 		}
+	}
+	return false
+}
+
+var _ = Configs(nil).Merge(nil)
 
-		return c
+// Merge returns the configs with in added after c, like a config file
+// read after the one of c. As ssh uses the first value obtained for every
+// keyword, the settings of c take precedence, and the global settings
+// of in apply only after the blocks of c.
+func (c Configs) Merge(in Configs) Configs {
+	var (
+		merged Configs
+		global = c.global()
+	)
+
+	for _, cfg := range c {
+		if cfg != global {
+			merged = append(merged, cfg)
+		}
 	}
 
-	return c
+	for _, cfg := range in {
+		if cfg.Host.Equal(globalHost) {
+			cfg = cfg.clone()
+			cfg.Host = allHosts
+		}
+
+		merged = append(merged, cfg)
+	}
+
+	if global == nil {
+		global = &Config{Host: globalHost}
+	}
+
+	return append(merged, global)
 }
 
 func (c Configs) append(cfg *Config, hosts ...Host) Configs {
@@ -277,30 +652,173 @@ func (c Configs) append(cfg *Config, hosts ...Host) Configs {
 func (c Configs) clone() Configs {
 	var cCopy Configs
 
-	if err := merge(&cCopy, c); err != nil {
-		panic("unexpected error: " + err.Error())
+	for _, cfg := range c {
+		cCopy = append(cCopy, cfg.clone())
 	}
 
 	return cCopy
 }
 
 var globToRegexp = strings.NewReplacer(
-	".", `\.`,
-	"*", ".*",
-	"?", ".",
+	`\*`, ".*",
+	`\?`, ".",
 )
 
+// parseHosts returns the patterns of a Host line, matching whole host
+// names regardless of their case, like ssh does.
+func parseHosts(patterns string) ([]Host, error) {
+	var hosts []Host
+
+	for _, host := range strings.Fields(patterns) {
+		r, err := regexp.Compile("(?i)^" + globToRegexp.Replace(regexp.QuoteMeta(host)) + "$")
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", host, err)
+		}
+
+		hosts = append(hosts, Host{r})
+	}
+
+	return hosts, nil
+}
+
+// negated reports whether any of the patterns of a Host line is negated.
+// Such lines are matched with a host criterion, as a negated pattern
+// excludes the host even if the other patterns match it.
+func negated(patterns string) bool {
+	for _, pattern := range strings.Fields(patterns) {
+		if strings.HasPrefix(pattern, "!") {
+			return true
+		}
+	}
+	return false
+}
+
+var DefaultParser = &Parser{}
+
+type Parser struct {
+	Strict bool
+	Warn   func(error)
+
+	// Include, if set, is called with every Include pattern, made absolute,
+	// before it is expanded.
+	Include func(pattern string)
+
+	// User, if set, is the local user the configs are parsed for, instead
+	// of the current one. The tilde prefixes and the %d, %u and %i tokens
+	// are expanded for that user while parsing.
+	User *user.User
+
+	// CheckFile, if set, is called with every config file before it is
+	// read, including the included ones, and with every identity file
+	// named in the configs, for which private is true. A config file
+	// failing the check is an error, an identity file is skipped with
+	// a warning.
+	CheckFile func(path string, private bool) error
+}
+
 func ParseConfigFile(path string) (Configs, error) {
+	return DefaultParser.ParseConfigFile(path)
+}
+
+func ParseConfig(r io.Reader) (Configs, error) {
+	return DefaultParser.ParseConfig(r)
+}
+
+func (p *Parser) ParseConfigFile(path string) (Configs, error) {
+	configs, err := p.parseConfigFile(path, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return configs, p.finish(configs...)
+}
+
+func (p *Parser) ParseConfig(r io.Reader) (Configs, error) {
+	dir := ""
+	if u, err := p.user(); err == nil {
+		dir = filepath.Join(u.HomeDir, ".ssh")
+	} else if home, err := os.UserHomeDir(); err == nil {
+		dir = filepath.Join(home, ".ssh")
+	}
+
+	configs, err := p.parseConfig(r, "", dir, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return configs, p.finish(configs...)
+}
+
+func (p *Parser) parseConfigFile(path string, depth int, scope Match) (Configs, error) {
+	if p.CheckFile != nil {
+		if err := p.CheckFile(path, false); err != nil {
+			return nil, err
+		}
+	}
+
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 
-	return ParseConfig(f)
+	return p.parseConfig(f, path, filepath.Dir(path), depth, scope)
 }
 
-func ParseConfig(r io.Reader) (Configs, error) {
+const maxIncludeDepth = 16
+
+// include parses the files matching the patterns. Their global settings
+// are merged into tmp, their Host and Match blocks apply only to hosts
+// matched by the scope, which are the criteria of the block the Include
+// is in.
+func (p *Parser) include(value, dir string, depth int, scope Match, tmp values, origins *Origins) (Configs, error) {
+	if depth >= maxIncludeDepth {
+		return nil, errors.New("maximum include depth exceeded")
+	}
+
+	var configs Configs
+
+	for _, pattern := range strings.Fields(value) {
+		pattern, err := expandTilde(pattern, p.User)
+		if err != nil {
+			return nil, err
+		}
+
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+
+		if p.Include != nil {
+			p.Include(pattern)
+		}
+
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+		}
+
+		for _, file := range files {
+			cfgs, err := p.parseConfigFile(file, depth+1, scope)
+			if err != nil {
+				return nil, fmt.Errorf("failed to include %q: %w", file, err)
+			}
+
+			n := len(cfgs) - 1
+
+			if err := tmp.merge(cfgs[n]); err != nil {
+				return nil, fmt.Errorf("failed to include %q: %w", file, err)
+			}
+
+			origins.merge(cfgs[n].Origins)
+
+			configs = append(configs, cfgs[:n]...)
+		}
+	}
+
+	return configs, nil
+}
+
+func (p *Parser) parseConfig(r io.Reader, file, dir string, depth int, scope Match) (Configs, error) {
 	const (
 		stateGlobal = 1 << iota
 		stateHost
@@ -312,8 +830,13 @@ func ParseConfig(r io.Reader) (Configs, error) {
 		local   *Config
 		configs Configs
 		hosts   []Host
-		tmp     = make(map[string]string)
+		tmp     = make(values)
+		origins Origins
+		block   string
+		within  = scope // criteria of the current block
+		ignore  string
 		state   = stateGlobal
+		segment bool // whether the global settings follow included blocks
 		lineno  = 1
 	)
 
@@ -324,75 +847,312 @@ func ParseConfig(r io.Reader) (Configs, error) {
 		switch {
 		case strings.HasPrefix(ts, "#") || ts == "":
 			// ignore line
-		case strings.HasPrefix(s, " ") || strings.HasPrefix(s, "\t"):
+		case isBlock(ts):
 			switch state {
 			case stateGlobal:
-				return nil, fmt.Errorf("unexpected indentation at line %d", lineno)
+				var err error
+				if configs, err = p.global(configs, global, tmp, origins, segment); err != nil {
+					return nil, lineError(file, lineno, "", err)
+				}
+
+				state = stateHost
 			case stateHost:
-				k, v, err := parsekv(ts)
-				if err != nil {
-					return nil, fmt.Errorf("unexpected line %d: %s", lineno, err)
+				if err := merge(local, tmp); err != nil {
+					return nil, lineError(file, lineno, "", fmt.Errorf("unexpected host configuration %+v: %w", tmp, err))
+				}
+
+				local.Origins = origins
+				configs = configs.append(local, hosts...)
+			}
+
+			tmp, local, hosts, origins, block = make(values), new(Config), hosts[:0], nil, ts
+
+			k, v, err := parsekv(ts)
+			if err != nil {
+				return nil, lineError(file, lineno, "", fmt.Errorf("unexpected line: %w", err))
+			}
 
+			if strings.EqualFold(k, "Match") {
+				m, err := ParseMatch(v)
+				if err != nil {
+					return nil, lineError(file, lineno, "Match", fmt.Errorf("unexpected match %q: %w", v, err))
 				}
 
-				tmp[strings.ToLower(k)] = v
+				within = append(scope[:len(scope):len(scope)], m...)
+				local.Match, hosts = within, append(hosts, Host{})
+
+				continue
+			}
+
+			if hosts, err = parseHosts(v); err != nil {
+				return nil, lineError(file, lineno, "Host", fmt.Errorf("unexpected host: %w", err))
 			}
-		case strings.HasPrefix(s, "Host "):
+
+			within = append(scope[:len(scope):len(scope)], Criterion{
+				Keyword: "host",
+				Arg:     strings.Join(strings.Fields(v), ","),
+			})
+
+			if len(scope) != 0 || negated(v) {
+				local.Match, hosts = within, append(hosts[:0], Host{})
+			}
+		case strings.HasPrefix(s, " ") || strings.HasPrefix(s, "\t"):
 			switch state {
 			case stateGlobal:
-				if err := merge(global, tmp); err != nil {
-					return nil, fmt.Errorf("unexpected host configuration at line %d: %+v (%s)", lineno, tmp, err)
-				}
-
-				state = stateHost
+				return nil, lineError(file, lineno, "", errors.New("unexpected indentation"))
 			case stateHost:
-				if err := merge(local, tmp); err != nil {
-					return nil, fmt.Errorf("unexpected host configuration at line %d: %+v (%s)", lineno, tmp, err)
+				k, v, err := parsekv(ts)
+				if err != nil {
+					return nil, lineError(file, lineno, "", fmt.Errorf("unexpected line: %w", err))
+
 				}
 
-				configs = configs.append(local, hosts...)
-			}
+				if strings.EqualFold(k, "Include") {
+					included, err := p.include(v, dir, depth, within, tmp, &origins)
+					if err != nil {
+						return nil, lineError(file, lineno, "Include", err)
+					}
+
+					// The settings which follow the included blocks apply
+					// after them, so the block is continued by a new one.
+					if len(included) != 0 && len(tmp) != 0 {
+						if err := merge(local, tmp); err != nil {
+							return nil, lineError(file, lineno, "Include", fmt.Errorf("unexpected host configuration %+v: %w", tmp, err))
+						}
+
+						local.Origins = origins
+						configs = configs.append(local, hosts...)
 
-			tmp, local, hosts = make(map[string]string), new(Config), hosts[:0]
+						tmp, origins, local = make(values), nil, &Config{Match: local.Match}
+					}
 
-			for _, host := range strings.Split(strings.TrimSpace(strings.TrimPrefix(ts, "Host")), " ") {
-				r, err := regexp.Compile(globToRegexp.Replace(strings.TrimSpace(host)))
+					configs = append(configs, included...)
+
+					continue
+				}
+
+				k, ok, err := p.keyword(k, lineno, ignore)
 				if err != nil {
-					return nil, fmt.Errorf("unexpected host at line %d: %q (%s)", lineno, host, err)
+					return nil, &ssh.ConfigError{File: file, Err: err}
+				}
+				if !ok {
+					continue
+				}
+				if k == "ignoreunknown" {
+					ignore = v
 				}
 
-				hosts = append(hosts, Host{r})
+				if tmp.set(k, v) {
+					origins.merge(Origins{k: {File: file, Line: lineno, Block: block}})
+				}
 			}
 		default:
 			switch state {
 			case stateGlobal:
 				k, v, err := parsekv(ts)
 				if err != nil {
-					return nil, fmt.Errorf("unexpected line %d: %s", lineno, err)
+					return nil, lineError(file, lineno, "", fmt.Errorf("unexpected line: %w", err))
 				}
 
-				tmp[k] = v
+				if strings.EqualFold(k, "Include") {
+					included, err := p.include(v, dir, depth, within, tmp, &origins)
+					if err != nil {
+						return nil, lineError(file, lineno, "Include", err)
+					}
+
+					// The global settings which follow the included blocks
+					// apply after them.
+					if len(included) != 0 {
+						if configs, err = p.global(configs, global, tmp, origins, segment); err != nil {
+							return nil, lineError(file, lineno, "Include", err)
+						}
+
+						tmp, origins, segment = make(values), nil, true
+					}
+
+					configs = append(configs, included...)
+
+					continue
+				}
+
+				k, ok, err := p.keyword(k, lineno, ignore)
+				if err != nil {
+					return nil, &ssh.ConfigError{File: file, Err: err}
+				}
+				if !ok {
+					continue
+				}
+				if k == "ignoreunknown" {
+					ignore = v
+				}
+
+				if tmp.set(k, v) {
+					origins.merge(Origins{k: {File: file, Line: lineno, Block: block}})
+				}
 			case stateHost:
-				return nil, fmt.Errorf("unexpected line %d", lineno)
+				return nil, lineError(file, lineno, "", errors.New("unexpected line"))
 			}
 		}
 	}
 
 	if len(tmp) != 0 && len(hosts) != 0 && state == stateHost {
 		if err := merge(local, tmp); err != nil {
-			return nil, fmt.Errorf("unexpected host configuration at line %d: %+v (%s)", lineno, tmp, err)
+			return nil, lineError(file, lineno, "", fmt.Errorf("unexpected host configuration %+v: %w", tmp, err))
 		}
 
+		local.Origins = origins
 		configs = configs.append(local, hosts...)
 
 		tmp, local, hosts = nil, nil, hosts[:0]
 	}
 
+	if state == stateGlobal {
+		var err error
+		if configs, err = p.global(configs, global, tmp, origins, segment); err != nil {
+			return nil, &ssh.ConfigError{File: file, Err: err}
+		}
+	}
+
 	configs = configs.append(global, globalHost)
 
 	return configs, nil
 }
 
+// global sets the global settings. The ones following included blocks
+// are a segment, which is added to the configs as a block for all hosts,
+// so that it applies after the included blocks.
+func (p *Parser) global(configs Configs, global *Config, tmp values, origins Origins, segment bool) (Configs, error) {
+	if !segment {
+		if err := merge(global, tmp); err != nil {
+			return nil, fmt.Errorf("unexpected global configuration %+v: %w", tmp, err)
+		}
+
+		global.Origins = origins
+
+		return configs, nil
+	}
+
+	if len(tmp) == 0 {
+		return configs, nil
+	}
+
+	cfg := new(Config)
+
+	if err := merge(cfg, tmp); err != nil {
+		return nil, fmt.Errorf("unexpected global configuration %+v: %w", tmp, err)
+	}
+
+	cfg.Origins = origins
+
+	return configs.append(cfg, allHosts), nil
+}
+
+// lineError annotates the error with the file, the line and the keyword
+// it was caused by.
+func lineError(file string, line int, keyword string, err error) error {
+	return &ssh.ConfigError{File: file, Line: line, Keyword: keyword, Err: err}
+}
+
+func isBlock(line string) bool {
+	k, _, err := parsekv(line)
+	return err == nil && (strings.EqualFold(k, "Host") || strings.EqualFold(k, "Match"))
+}
+
+func (p *Parser) keyword(k string, line int, ignore string) (string, bool, error) {
+	kw, ok := Keyword(k)
+	if ok {
+		return kw, true, nil
+	}
+
+	if ignore != "" && matchList(strings.ToLower(ignore), kw) {
+		return "", false, nil
+	}
+
+	err := &UnknownKeywordError{Line: line, Keyword: k}
+
+	if _, ok := deprecatedKeywords[kw]; ok {
+		err.Reason = "deprecated keyword"
+		p.warn(err)
+		return "", false, nil
+	}
+
+	if p.Strict {
+		return "", false, err
+	}
+
+	p.warn(err)
+
+	return "", false, nil
+}
+
+func (p *Parser) warn(err error) {
+	if p.Warn != nil {
+		p.Warn(err)
+	}
+}
+
+func (p *Parser) user() (*user.User, error) {
+	if p.User != nil {
+		return p.User, nil
+	}
+	return user.Current()
+}
+
+// finish expands the configs for the user of the parser, if it is set,
+// and skips the identity files failing CheckFile.
+func (p *Parser) finish(configs ...*Config) error {
+	for _, cfg := range configs {
+		if p.User != nil {
+			if err := cfg.expandUser(p.User); err != nil {
+				return err
+			}
+		}
+
+		if p.CheckFile == nil || len(cfg.IdentityFile) == 0 {
+			continue
+		}
+
+		var identity []string
+
+		for _, file := range cfg.IdentityFile {
+			if path, ok := p.localPath(file); ok {
+				if err := p.CheckFile(path, true); err != nil {
+					p.warn(fmt.Errorf("ignoring identity file: %w", err))
+					continue
+				}
+			}
+
+			identity = append(identity, file)
+		}
+
+		cfg.IdentityFile = identity
+	}
+
+	return nil
+}
+
+// localPath returns the path of the file, if it does not depend
+// on the host the config is used for.
+func (p *Parser) localPath(file string) (string, bool) {
+	if strings.Contains(file, "${") {
+		return "", false
+	}
+
+	u, err := p.user()
+	if err != nil {
+		return "", false
+	}
+
+	path, err := expandTilde(file, u)
+	if err != nil {
+		return "", false
+	}
+
+	path = expandTokens(path, tokens{'d': u.HomeDir, 'u': u.Username, 'i': u.Uid}, tokensFile)
+
+	return path, !strings.Contains(path, "%")
+}
+
 func merge(orig interface{}, in ...interface{}) error {
 	if len(in) == 0 {
 		return nil
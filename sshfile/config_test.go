@@ -1,25 +1,36 @@
 package sshfile_test
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/glaucusio/ssh"
 	"github.com/glaucusio/ssh/sshfile"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 func TestConfig(t *testing.T) {
 	want := &sshfile.Config{
 		Port:                  22,
-		StrictHostKeyChecking: sshfile.Boolean(true),
-		GlobalKnownHostsFile:  "/dev/null",
-		UserKnownHostsFile:    "/dev/null",
+		StrictHostKeyChecking: sshfile.HostKeyCheckingAcceptNew,
+		GlobalKnownHostsFile:  sshfile.Strings{"/dev/null"},
+		UserKnownHostsFile:    sshfile.Strings{"/dev/null", "/dev/zero"},
 		TcpKeepAlive:          sshfile.Boolean(true),
 		ConnectTimeout:        sshfile.Duration(10 * time.Second),
 		ConnectionAttempts:    3,
 		ServerAliveInterval:   sshfile.Duration(5 * time.Second),
 		ServerAliveCountMax:   10,
+		RekeyLimit:            &sshfile.RekeyLimit{Data: 1 << 30, Time: sshfile.Duration(time.Hour)},
+		UpdateHostKeys:        sshfile.AskAsk,
 	}
 
 	p, err := json.MarshalIndent(want, "", "\t")
@@ -80,11 +91,13 @@ func TestParseArgs(t *testing.T) {
 
 	for i, flags := range tests {
 		t.Run("", func(t *testing.T) {
-			got, err := sshfile.ParseArgs(flags)
+			inv, err := sshfile.ParseArgs(flags)
 			if err != nil {
 				t.Fatalf("ParseArgs()=%s", err)
 			}
 
+			got := inv.Config
+
 			if *updateGolden {
 				wants = append(wants, got)
 				return
@@ -102,3 +115,686 @@ func TestParseArgs(t *testing.T) {
 		}
 	}
 }
+
+func TestParseArgsInvocation(t *testing.T) {
+	tests := []struct {
+		args []string
+		want *sshfile.Invocation
+	}{{
+		[]string{"-p", "2222", "-l", "admin", "-i", "~/.ssh/a", "-i", "~/.ssh/b", "-J", "jump", "-4", "-A", "-C",
+			"-F", "/tmp/config", "-E", "/tmp/log", "-L", "8080:localhost:80", "-L", "8443:localhost:443",
+			"-D", "1080", "-vv", "-tt", "-N", "-f", "-o", "ConnectTimeout=10", "root@web:22", "ls", "-l"},
+		&sshfile.Invocation{
+			Config: &sshfile.Config{
+				Port:                    2222,
+				User:                    "admin",
+				IdentityFile:            sshfile.Strings{"~/.ssh/a", "~/.ssh/b"},
+				ProxyJump:               "jump",
+				AddressFamily:           "inet",
+				ForwardAgent:            "yes",
+				Compression:             sshfile.Boolean(true),
+				LogLevel:                "DEBUG2",
+				RequestTTY:              "force",
+				SessionType:             "none",
+				ForkAfterAuthentication: sshfile.Boolean(true),
+				ConnectTimeout:          sshfile.Duration(10 * time.Second),
+			},
+			ConfigFile:     "/tmp/config",
+			LogFile:        "/tmp/log",
+			Destination:    "root@web:22",
+			Host:           "web",
+			Command:        []string{"ls", "-l"},
+			LocalForward:   []string{"8080:localhost:80", "8443:localhost:443"},
+			DynamicForward: []string{"1080"},
+		},
+	}, {
+		[]string{"ssh://deploy@[::1]:2200", "-q", "--", "-x"},
+		&sshfile.Invocation{
+			Config: &sshfile.Config{
+				Port:     2200,
+				User:     "deploy",
+				LogLevel: "QUIET",
+			},
+			Destination: "ssh://deploy@[::1]:2200",
+			Host:        "::1",
+			Command:     []string{"-x"},
+		},
+	}, {
+		[]string{"ssh://admin;fingerprint=ssh-ed25519-c1-b1-30@[fe80::1%25eth0]:2222", "uptime"},
+		&sshfile.Invocation{
+			Config: &sshfile.Config{
+				Port: 2222,
+				User: "admin",
+			},
+			Destination: "ssh://admin;fingerprint=ssh-ed25519-c1-b1-30@[fe80::1%25eth0]:2222",
+			Host:        "fe80::1%eth0",
+			Fingerprint: "ssh-ed25519-c1-b1-30",
+			Command:     []string{"uptime"},
+		},
+	}, {
+		[]string{"-o", "User=admin", "root@[::1]:2200"},
+		&sshfile.Invocation{
+			Config: &sshfile.Config{
+				Port: 2200,
+				User: "admin",
+			},
+			Destination: "root@[::1]:2200",
+			Host:        "::1",
+		},
+	}, {
+		[]string{"-o", "Port=2200", "-o", "Port=2300", "-o", "IdentityFile=~/.ssh/a", "-i", "~/.ssh/b",
+			"-o", "IdentityFile=~/.ssh/c", "-l", "admin", "-o", "User=root", "-p", "2400", "-l", "deploy", "web"},
+		&sshfile.Invocation{
+			Config: &sshfile.Config{
+				Port:         2400,
+				User:         "deploy",
+				IdentityFile: sshfile.Strings{"~/.ssh/a", "~/.ssh/b", "~/.ssh/c"},
+			},
+			Destination: "web",
+			Host:        "web",
+		},
+	}, {
+		[]string{"-W", "db:5432", "fe80::1"},
+		&sshfile.Invocation{
+			Config:       &sshfile.Config{},
+			Destination:  "fe80::1",
+			Host:         "fe80::1",
+			StdioForward: "db:5432",
+		},
+	}}
+
+	ignoreOrigins := cmpopts.IgnoreFields(sshfile.Config{}, "Origins")
+
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			got, err := sshfile.ParseArgs(test.args)
+			if err != nil {
+				t.Fatalf("ParseArgs()=%s", err)
+			}
+
+			if !cmp.Equal(got, test.want, ignoreOrigins) {
+				t.Fatalf("got != want:\n%s\n", cmp.Diff(got, test.want, ignoreOrigins))
+			}
+		})
+	}
+
+	for _, args := range [][]string{
+		{"web:0"},
+		{"ssh://web/path"},
+		{"web:/tmp/file"},
+		{"[::1:22"},
+		{"user@:22"},
+		{"-X", "web"},
+	} {
+		if _, err := sshfile.ParseArgs(args); err == nil {
+			t.Fatalf("ParseArgs(%q): expected error", args)
+		}
+	}
+}
+
+func TestParseConfigUnknown(t *testing.T) {
+	const config = `IgnoreUnknown UseKeychain,Foo*
+UseKeychain yes
+FooBar baz
+Protocol 2
+
+Host example
+	Ciphers +aes128-cbc
+	PubkeyAcceptedKeyTypes +ssh-rsa
+	Unknown yes
+`
+
+	var warnings []error
+
+	p := &sshfile.Parser{
+		Warn: func(err error) { warnings = append(warnings, err) },
+	}
+
+	got, err := p.ParseConfig(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("ParseConfig()=%s", err)
+	}
+
+	if len(warnings) != 2 {
+		t.Fatalf("got %d warnings, want 2: %v", len(warnings), warnings)
+	}
+
+	var uerr *sshfile.UnknownKeywordError
+
+	if !errors.As(warnings[1], &uerr) || uerr.Keyword != "Unknown" || uerr.Line != 9 {
+		t.Fatalf("unexpected warning: %v", warnings[1])
+	}
+
+	if got[0].Ciphers != "+aes128-cbc" || got[0].PubkeyAcceptedAlgorithms != "+ssh-rsa" {
+		t.Fatalf("unexpected config: %+v", got[0])
+	}
+
+	p.Strict = true
+
+	if _, err := p.ParseConfig(strings.NewReader(config)); !errors.As(err, &uerr) {
+		t.Fatalf("ParseConfig()=%v, want UnknownKeywordError", err)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		config  string
+		line    int
+		keyword string
+	}{
+		{"Host web\n\tPort 22\nUser admin\n", 3, ""},
+		{"\tPort 22\n", 1, ""},
+		{"Host web\n\tPort 22\nMatch unknown\n", 3, "Match"},
+	}
+
+	for _, test := range tests {
+		_, err := sshfile.ParseConfig(strings.NewReader(test.config))
+
+		var cerr *ssh.ConfigError
+
+		if !errors.As(err, &cerr) || cerr.Line != test.line || cerr.Keyword != test.keyword {
+			t.Errorf("%q: unexpected error: %v", test.config, err)
+		}
+	}
+}
+
+func TestConfigExpand(t *testing.T) {
+	os.Setenv("GOSSH_TEST_KEY", "id_work")
+
+	cfg := &sshfile.Config{
+		Hostname:           "%h.example.com",
+		User:               "deploy",
+		Port:               2222,
+		IdentityFile:       sshfile.Strings{"~/.ssh/${GOSSH_TEST_KEY}-%r@%h:%p"},
+		UserKnownHostsFile: sshfile.Strings{"/tmp/known_hosts_%n%%"},
+		ProxyCommand:       "nc %h %p",
+	}
+
+	got, err := cfg.Expand("web")
+	if err != nil {
+		t.Fatalf("Expand()=%s", err)
+	}
+
+	u, err := user.Current()
+	if err != nil {
+		t.Fatalf("user.Current()=%s", err)
+	}
+
+	want := &sshfile.Config{
+		Hostname:           "web.example.com",
+		User:               "deploy",
+		Port:               2222,
+		IdentityFile:       sshfile.Strings{filepath.Join(u.HomeDir, ".ssh", "id_work-deploy@web.example.com:2222")},
+		UserKnownHostsFile: sshfile.Strings{"/tmp/known_hosts_web%"},
+		ProxyCommand:       "nc web.example.com 2222",
+	}
+
+	if !cmp.Equal(got, want) {
+		t.Fatalf("got != want:\n%s\n", cmp.Diff(got, want))
+	}
+
+	for _, cfg := range []*sshfile.Config{
+		{Hostname: "%r"},
+		{IdentityFile: sshfile.Strings{"${GOSSH_TEST_UNSET}"}},
+		{ProxyCommand: "nc %d"},
+		{ControlPath: "%"},
+	} {
+		if _, err := cfg.Expand("web"); err == nil {
+			t.Errorf("Expand(%+v): expected error", cfg)
+		}
+	}
+}
+
+func TestParserUser(t *testing.T) {
+	const config = `Host web
+	IdentityFile ~/.ssh/id_%u
+	IdentityFile %d/.ssh/id_%h
+	IdentityFile /keys/id_web
+	UserKnownHostsFile %d/known_hosts /tmp/known_hosts_%%d
+	ControlPath ~/.ssh/cm-%i-%r@%h:%p
+`
+
+	var (
+		checked []string
+		warned  []error
+	)
+
+	p := &sshfile.Parser{
+		User: &user.User{Uid: "1001", Username: "bob", HomeDir: "/home/bob"},
+		Warn: func(err error) { warned = append(warned, err) },
+		CheckFile: func(path string, private bool) error {
+			if !private {
+				t.Errorf("CheckFile(%q): got config file, want identity file", path)
+			}
+			checked = append(checked, path)
+			if path == "/keys/id_web" {
+				return errors.New("bad permissions")
+			}
+			return nil
+		},
+	}
+
+	cfgs, err := p.ParseConfig(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("ParseConfig()=%s", err)
+	}
+
+	cfg, err := cfgs.Lookup(context.Background(), "web")
+	if err != nil {
+		t.Fatalf("Lookup()=%s", err)
+	}
+
+	want := &sshfile.Config{
+		IdentityFile:       sshfile.Strings{"/home/bob/.ssh/id_bob", "/home/bob/.ssh/id_%h"},
+		UserKnownHostsFile: sshfile.Strings{"/home/bob/known_hosts", "/tmp/known_hosts_%%d"},
+		ControlPath:        "/home/bob/.ssh/cm-1001-%r@%h:%p",
+	}
+
+	opts := cmpopts.IgnoreFields(sshfile.Config{}, "Host", "Origins")
+
+	if !cmp.Equal(cfg, want, opts) {
+		t.Fatalf("got != want:\n%s\n", cmp.Diff(cfg, want, opts))
+	}
+
+	if want := []string{"/home/bob/.ssh/id_bob", "/keys/id_web"}; !cmp.Equal(checked, want) {
+		t.Errorf("checked != want:\n%s\n", cmp.Diff(checked, want))
+	}
+
+	if len(warned) != 1 {
+		t.Errorf("got %d warnings, want 1: %v", len(warned), warned)
+	}
+}
+
+func TestConfigHostPatterns(t *testing.T) {
+	const config = `Host web 10.0.0.1
+	User web
+
+Host db* !db1
+	User db
+`
+
+	cfgs, err := sshfile.ParseConfig(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("ParseConfig()=%s", err)
+	}
+
+	for host, want := range map[string]string{
+		"web":                   "web",
+		"WEB":                   "web",
+		"webserver.example.com": "",
+		"www.web":               "",
+		"10.0.0.1":              "web",
+		"10x0x0x1":              "",
+		"db":                    "db",
+		"db2":                   "db",
+		"db1":                   "",
+		"mydb":                  "",
+	} {
+		cfg, err := cfgs.Lookup(context.Background(), host)
+		if err != nil {
+			t.Fatalf("Lookup(%q)=%s", host, err)
+		}
+
+		if cfg.User != want {
+			t.Errorf("%s: got %q user, want %q", host, cfg.User, want)
+		}
+	}
+}
+
+func TestConfigFirstWins(t *testing.T) {
+	const config = `User globaluser
+Port 2222
+
+Host foo
+	User hostuser
+	IdentityFile ~/.ssh/id_foo
+
+Host f*
+	User fuser
+	Hostname foo.example.com
+	IdentityFile ~/.ssh/id_f
+
+Host *
+	Port 2200
+	Hostname any.example.com
+`
+
+	cfgs, err := sshfile.ParseConfig(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("ParseConfig()=%s", err)
+	}
+
+	cases := map[string]struct {
+		user     string
+		hostname string
+		port     int
+		identity sshfile.Strings
+	}{
+		"foo": {"globaluser", "foo.example.com", 2222, sshfile.Strings{"~/.ssh/id_foo", "~/.ssh/id_f"}},
+		"fab": {"globaluser", "foo.example.com", 2222, sshfile.Strings{"~/.ssh/id_f"}},
+		"bar": {"globaluser", "any.example.com", 2222, nil},
+	}
+
+	for host, want := range cases {
+		cfg, err := cfgs.Lookup(context.Background(), host)
+		if err != nil {
+			t.Fatalf("Lookup(%q)=%s", host, err)
+		}
+
+		if cfg.User != want.user || cfg.Hostname != want.hostname || cfg.Port != want.port {
+			t.Errorf("%s: got %s@%s:%d, want %s@%s:%d", host, cfg.User, cfg.Hostname,
+				cfg.Port, want.user, want.hostname, want.port)
+		}
+
+		if want.identity != nil {
+			if !cmp.Equal(cfg.IdentityFile, want.identity) {
+				t.Errorf("%s: IdentityFile mismatch (-got +want):\n%s", host, cmp.Diff(cfg.IdentityFile, want.identity))
+			}
+		}
+	}
+}
+
+func TestConfigExport(t *testing.T) {
+	cfg := &sshfile.Config{
+		Port:                  2222,
+		StrictHostKeyChecking: sshfile.HostKeyCheckingAcceptNew,
+		UserKnownHostsFile:    sshfile.Strings{"~/.ssh/known_hosts", "~/.ssh/known_hosts2"},
+		IdentityFile:          sshfile.Strings{"~/.ssh/id_work", "~/My Keys/id_rsa"},
+		ConnectTimeout:        sshfile.Duration(30 * time.Second),
+		Compression:           sshfile.Boolean(true),
+		Hostname:              "10.0.0.1",
+		User:                  "deploy",
+		ProxyCommand:          "ssh -W %h:%p bastion",
+		RekeyLimit:            &sshfile.RekeyLimit{Data: 1 << 30, Time: sshfile.Duration(time.Hour)},
+	}
+
+	args := cfg.Args()
+
+	wantArgs := []string{
+		"-o", "Port=2222",
+		"-o", "StrictHostKeyChecking=accept-new",
+		"-o", "UserKnownHostsFile=~/.ssh/known_hosts ~/.ssh/known_hosts2",
+		"-o", "ConnectTimeout=30",
+		"-o", "HostName=10.0.0.1",
+		"-o", "User=deploy",
+		"-o", "IdentityFile=~/.ssh/id_work",
+		"-o", `IdentityFile="~/My Keys/id_rsa"`,
+		"-o", "Compression=yes",
+		"-o", "ProxyCommand=ssh -W %h:%p bastion",
+		"-o", "RekeyLimit=1G 3600",
+	}
+
+	if !cmp.Equal(args, wantArgs) {
+		t.Fatalf("got != want:\n%s\n", cmp.Diff(args, wantArgs))
+	}
+
+	ignore := cmpopts.IgnoreFields(sshfile.Config{}, "Origins", "Host")
+
+	inv, err := sshfile.ParseArgs(args)
+	if err != nil {
+		t.Fatalf("ParseArgs()=%s", err)
+	}
+
+	if !cmp.Equal(inv.Config, cfg, ignore) {
+		t.Fatalf("got != want:\n%s\n", cmp.Diff(inv.Config, cfg, ignore))
+	}
+
+	f := cfg.File("web")
+
+	const wantFile = `Host web
+	Port 2222
+	StrictHostKeyChecking accept-new
+	UserKnownHostsFile ~/.ssh/known_hosts ~/.ssh/known_hosts2
+	ConnectTimeout 30
+	HostName 10.0.0.1
+	User deploy
+	IdentityFile ~/.ssh/id_work
+	IdentityFile "~/My Keys/id_rsa"
+	Compression yes
+	ProxyCommand ssh -W %h:%p bastion
+	RekeyLimit 1G 3600
+`
+
+	if got := string(f.Bytes()); got != wantFile {
+		t.Fatalf("got != want:\n%s\n", cmp.Diff(got, wantFile))
+	}
+
+	configs, err := f.Configs()
+	if err != nil {
+		t.Fatalf("Configs()=%s", err)
+	}
+
+	got, err := configs.Lookup(context.Background(), "web")
+	if err != nil {
+		t.Fatalf("Lookup()=%s", err)
+	}
+
+	if !cmp.Equal(got, cfg, ignore) {
+		t.Fatalf("got != want:\n%s\n", cmp.Diff(got, cfg, ignore))
+	}
+}
+
+func TestConfigOptions(t *testing.T) {
+	cfg := &sshfile.Config{
+		Port:                2222,
+		User:                "deploy",
+		ConnectTimeout:      sshfile.Duration(30 * time.Second),
+		IdentityFile:        sshfile.Strings{"~/.ssh/id_work", "~/My Keys/id_rsa"},
+		ProxyJump:           "bastion,admin@gateway:2200",
+		ServerAliveInterval: sshfile.Duration(time.Minute),
+		ServerAliveCountMax: 5,
+		TcpKeepAlive:        sshfile.Boolean(false),
+		Ciphers:             "aes256-ctr,aes128-ctr",
+	}
+
+	got, err := sshfile.FromOptions(cfg.Options()...)
+	if err != nil {
+		t.Fatalf("FromOptions()=%s", err)
+	}
+
+	ignore := cmpopts.IgnoreFields(sshfile.Config{}, "Origins", "Host")
+
+	if !cmp.Equal(got, cfg, ignore) {
+		t.Fatalf("got != want:\n%s\n", cmp.Diff(got, cfg, ignore))
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	got, err := sshfile.ParseOptions([]string{
+		"User=admin",
+		"Port=2200",
+		"User=root",
+		"IdentityFile=~/.ssh/id_a",
+		"Port=2300",
+		"IdentityFile=~/.ssh/id_b",
+	})
+	if err != nil {
+		t.Fatalf("ParseOptions()=%s", err)
+	}
+
+	want := &sshfile.Config{
+		User:         "admin",
+		Port:         2200,
+		IdentityFile: sshfile.Strings{"~/.ssh/id_a", "~/.ssh/id_b"},
+	}
+
+	ignore := cmpopts.IgnoreFields(sshfile.Config{}, "Origins")
+
+	if !cmp.Equal(got, want, ignore) {
+		t.Fatalf("got != want:\n%s\n", cmp.Diff(got, want, ignore))
+	}
+}
+
+func TestClientConfigDestination(t *testing.T) {
+	const config = "Host web\n\tUser config\n\tStrictHostKeyChecking no\n"
+
+	cfgs, err := sshfile.ParseConfig(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("ParseConfig()=%s", err)
+	}
+
+	withOptions, err := sshfile.ParseConfig(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("ParseConfig()=%s", err)
+	}
+
+	mixin, err := sshfile.ParseOptions([]string{"User=cli"})
+	if err != nil {
+		t.Fatalf("ParseOptions()=%s", err)
+	}
+
+	for i := range withOptions {
+		if err := withOptions[i].Merge(mixin); err != nil {
+			t.Fatalf("Merge()=%s", err)
+		}
+	}
+
+	tests := []struct {
+		cfgs        sshfile.Configs
+		destination string
+		user        string
+	}{
+		{cfgs, "web", "config"},
+		{cfgs, "admin@web", "admin"},
+		{withOptions, "web", "cli"},
+		{withOptions, "admin@web", "cli"},
+	}
+
+	for _, test := range tests {
+		c := &ssh.Client{ConfigCallback: test.cfgs.Callback()}
+
+		cfg, err := c.Config(context.Background(), "tcp", test.destination)
+		if err != nil {
+			t.Fatalf("Config(%q)=%s", test.destination, err)
+		}
+
+		if cfg.User != test.user {
+			t.Errorf("Config(%q): User=%q, want %q", test.destination, cfg.User, test.user)
+		}
+	}
+}
+
+func TestConfigMerge(t *testing.T) {
+	cfg := &sshfile.Config{
+		User:               "global",
+		IdentityFile:       sshfile.Strings{"~/.ssh/id_ed25519", "~/.ssh/id_rsa"},
+		UserKnownHostsFile: sshfile.Strings{"~/.ssh/known_hosts"},
+	}
+
+	in := &sshfile.Config{
+		User:               "local",
+		IdentityFile:       sshfile.Strings{"~/.ssh/id_work", "~/.ssh/id_rsa"},
+		UserKnownHostsFile: sshfile.Strings{"~/.ssh/known_hosts_work"},
+	}
+
+	if err := cfg.Merge(in); err != nil {
+		t.Fatalf("Merge()=%s", err)
+	}
+
+	want := &sshfile.Config{
+		User:               "local",
+		IdentityFile:       sshfile.Strings{"~/.ssh/id_work", "~/.ssh/id_rsa", "~/.ssh/id_ed25519"},
+		UserKnownHostsFile: sshfile.Strings{"~/.ssh/known_hosts_work"},
+	}
+
+	if !cmp.Equal(cfg, want) {
+		t.Fatalf("got != want:\n%s\n", cmp.Diff(cfg, want))
+	}
+}
+
+func TestParseConfigInclude(t *testing.T) {
+	const config = `Include config.d/*
+User admin
+
+Host web
+	Hostname web.example.com
+`
+
+	dir, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatalf("Abs()=%s", err)
+	}
+
+	f, err := ioutil.TempFile(dir, "config-include-*")
+	if err != nil {
+		t.Fatalf("TempFile()=%s", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(config); err != nil {
+		t.Fatalf("WriteString()=%s", err)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close()=%s", err)
+	}
+
+	cfgs, err := sshfile.ParseConfigFile(f.Name())
+	if err != nil {
+		t.Fatalf("ParseConfigFile()=%s", err)
+	}
+
+	build, err := cfgs.Lookup(context.Background(), "build")
+	if err != nil {
+		t.Fatalf("Lookup()=%s", err)
+	}
+
+	if build.Hostname != "build.example.com" || build.User != "ci" {
+		t.Errorf("unexpected build config: %+v", build)
+	}
+
+	web, err := cfgs.Lookup(context.Background(), "web")
+	if err != nil {
+		t.Fatalf("Lookup()=%s", err)
+	}
+
+	if want := (sshfile.Strings{"~/.ssh/id_work"}); web.User != "admin" || !cmp.Equal(web.IdentityFile, want) {
+		t.Errorf("unexpected web config: %+v", web)
+	}
+}
+
+func TestParseConfigIncludeScope(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshfile")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"config":    "Host prod-*\n\tInclude prod.conf\n\tUser deploy\n\nHost *\n\tUser nobody\n",
+		"prod.conf": "Port 2222\n\nHost *-db\n\tHostname db.internal\n",
+	}
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile()=%s", err)
+		}
+	}
+
+	cfgs, err := sshfile.ParseConfigFile(filepath.Join(dir, "config"))
+	if err != nil {
+		t.Fatalf("ParseConfigFile()=%s", err)
+	}
+
+	cases := []struct {
+		host     string
+		hostname string
+		user     string
+		port     int
+	}{
+		{"prod-db", "db.internal", "deploy", 2222},
+		{"prod-web", "", "deploy", 2222},
+		{"dev-db", "", "nobody", 0},
+	}
+
+	for _, cas := range cases {
+		got, err := cfgs.Lookup(context.Background(), cas.host)
+		if err != nil {
+			t.Fatalf("%s: Lookup()=%s", cas.host, err)
+		}
+
+		if got.Hostname != cas.hostname || got.User != cas.user || got.Port != cas.port {
+			t.Errorf("%s: unexpected config: %+v", cas.host, got)
+		}
+	}
+}
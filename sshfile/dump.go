@@ -0,0 +1,157 @@
+package sshfile
+
+import "strings"
+
+// dumpOrder lists the keywords in the order ssh -G prints them, together
+// with the values ssh uses when they are not set. Keywords without
+// a default are printed only when set.
+var dumpOrder = []struct {
+	keyword, value string
+}{
+	{"user", ""},
+	{"hostname", ""},
+	{"port", "22"},
+	{"addressfamily", "any"},
+	{"batchmode", "no"},
+	{"canonicalizefallbacklocal", "yes"},
+	{"canonicalizehostname", "false"},
+	{"checkhostip", "no"},
+	{"compression", "no"},
+	{"controlmaster", "false"},
+	{"enablesshkeysign", "no"},
+	{"clearallforwardings", "no"},
+	{"exitonforwardfailure", "no"},
+	{"fingerprinthash", "SHA256"},
+	{"forwardx11", "no"},
+	{"forwardx11trusted", "no"},
+	{"gatewayports", "no"},
+	{"gssapiauthentication", "no"},
+	{"gssapidelegatecredentials", "no"},
+	{"hashknownhosts", "no"},
+	{"hostbasedauthentication", "no"},
+	{"identitiesonly", "no"},
+	{"kbdinteractiveauthentication", "yes"},
+	{"nohostauthenticationforlocalhost", "no"},
+	{"passwordauthentication", "yes"},
+	{"permitlocalcommand", "no"},
+	{"proxyusefdpass", "no"},
+	{"pubkeyauthentication", "true"},
+	{"requesttty", "auto"},
+	{"sessiontype", "default"},
+	{"stdinnull", "no"},
+	{"forkafterauthentication", "no"},
+	{"streamlocalbindunlink", "no"},
+	{"stricthostkeychecking", "ask"},
+	{"tcpkeepalive", "yes"},
+	{"tunnel", "false"},
+	{"verifyhostkeydns", "false"},
+	{"visualhostkey", "no"},
+	{"updatehostkeys", "false"},
+	{"enableescapecommandline", "no"},
+	{"canonicalizemaxdots", "1"},
+	{"connectionattempts", "1"},
+	{"forwardx11timeout", "1200"},
+	{"numberofpasswordprompts", "3"},
+	{"serveralivecountmax", "3"},
+	{"serveraliveinterval", "0"},
+	{"requiredrsasize", "1024"},
+	{"bindaddress", ""},
+	{"bindinterface", ""},
+	{"ciphers", ""},
+	{"controlpath", ""},
+	{"hostkeyalgorithms", ""},
+	{"hostkeyalias", ""},
+	{"hostbasedacceptedalgorithms", ""},
+	{"identityagent", ""},
+	{"ignoreunknown", ""},
+	{"kbdinteractivedevices", ""},
+	{"kexalgorithms", ""},
+	{"casignaturealgorithms", ""},
+	{"localcommand", ""},
+	{"remotecommand", ""},
+	{"loglevel", "INFO"},
+	{"macs", ""},
+	{"pkcs11provider", ""},
+	{"securitykeyprovider", "internal"},
+	{"syslogfacility", "USER"},
+	{"tag", ""},
+	{"xauthlocation", "/usr/bin/xauth"},
+	{"knownhostscommand", ""},
+	{"pubkeyacceptedalgorithms", ""},
+	{"dynamicforward", ""},
+	{"localforward", ""},
+	{"remoteforward", ""},
+	{"identityfile", ""},
+	{"canonicaldomains", ""},
+	{"certificatefile", ""},
+	{"globalknownhostsfile", "/etc/ssh/ssh_known_hosts /etc/ssh/ssh_known_hosts2"},
+	{"userknownhostsfile", "~/.ssh/known_hosts ~/.ssh/known_hosts2"},
+	{"sendenv", ""},
+	{"setenv", ""},
+	{"logverbose", ""},
+	{"channeltimeout", ""},
+	{"permitremoteopen", ""},
+	{"addkeystoagent", "false"},
+	{"forwardagent", "no"},
+	{"connecttimeout", "none"},
+	{"tunneldevice", "any:any"},
+	{"canonicalizepermittedcnames", "none"},
+	{"controlpersist", "no"},
+	{"escapechar", "~"},
+	{"ipqos", "af21 cs1"},
+	{"rekeylimit", "0 0"},
+	{"streamlocalbindmask", "0177"},
+	{"obscurekeystroketiming", "interval:20"},
+	{"proxycommand", ""},
+	{"proxyjump", ""},
+}
+
+// dumpAlgorithms are the algorithm list keywords evaluated by Dump
+// against the defaults the connections are made with.
+var dumpAlgorithms = map[string][]string{
+	"ciphers":           defaultAlgorithms.Ciphers,
+	"hostkeyalgorithms": defaultHostKeyAlgorithms,
+	"kexalgorithms":     defaultAlgorithms.KeyExchanges,
+	"macs":              defaultAlgorithms.MACs,
+}
+
+// Dump returns settings for all keywords, in the order ssh -G prints them.
+// Keywords that are not set are reported with their default values and
+// "default" origin, algorithm lists are evaluated against the defaults.
+func (c *Config) Dump() []Setting {
+	set := make(map[string][]Setting)
+
+	for _, s := range c.Settings() {
+		set[s.Keyword] = append(set[s.Keyword], s)
+	}
+
+	var settings []Setting
+
+	for _, d := range dumpOrder {
+		s, ok := set[d.keyword]
+		delete(set, d.keyword)
+
+		if !ok && d.value != "" {
+			s = []Setting{{Keyword: d.keyword, Value: d.value, Origin: Origin{Source: "default"}}}
+		}
+
+		if defaults, ok := dumpAlgorithms[d.keyword]; ok {
+			if len(s) == 0 {
+				s = []Setting{{Keyword: d.keyword, Origin: Origin{Source: "default"}}}
+			}
+			if algs := algorithms(s[0].Value, defaults); len(algs) != 0 {
+				s[0].Value = strings.Join(algs, ",")
+			} else {
+				s[0].Value = strings.Join(defaults, ",")
+			}
+		}
+
+		settings = append(settings, s...)
+	}
+
+	for _, k := range keywordOrder {
+		settings = append(settings, set[k]...)
+	}
+
+	return settings
+}
@@ -0,0 +1,93 @@
+package sshfile_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/glaucusio/ssh/sshfile"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConfigDump(t *testing.T) {
+	const config = `Host web
+	Hostname web.example.com
+	User admin
+	IdentityFile ~/.ssh/id_web
+	IdentityFile ~/.ssh/id_rsa
+	Ciphers aes128-ctr
+	ConnectTimeout 10
+`
+
+	cfgs, err := sshfile.ParseConfig(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("ParseConfig()=%s", err)
+	}
+
+	cfg, err := cfgs.Lookup(context.Background(), "web")
+	if err != nil {
+		t.Fatalf("Lookup()=%s", err)
+	}
+
+	dump := cfg.Dump()
+
+	var got []string
+	for _, s := range dump {
+		got = append(got, s.String())
+	}
+
+	head := []string{
+		"user admin",
+		"hostname web.example.com",
+		"port 22",
+		"addressfamily any",
+	}
+
+	if !cmp.Equal(got[:len(head)], head) {
+		t.Fatalf("got != want:\n%s", cmp.Diff(got[:len(head)], head))
+	}
+
+	index := make(map[string]int)
+	for i, s := range got {
+		if _, ok := index[s]; !ok {
+			index[s] = i
+		}
+	}
+
+	order := []string{
+		"identitiesonly no",
+		"canonicalizemaxdots 1",
+		"ciphers aes128-ctr",
+		"identityfile ~/.ssh/id_web",
+		"identityfile ~/.ssh/id_rsa",
+		"userknownhostsfile ~/.ssh/known_hosts ~/.ssh/known_hosts2",
+		"connecttimeout 10",
+		"rekeylimit 0 0",
+	}
+
+	for i, s := range order {
+		j, ok := index[s]
+		if !ok {
+			t.Fatalf("missing %q in %q", s, got)
+		}
+		if i != 0 && j < index[order[i-1]] {
+			t.Errorf("%q printed before %q", s, order[i-1])
+		}
+	}
+
+	for _, s := range dump {
+		switch s.Keyword {
+		case "hostname", "user", "identityfile", "ciphers", "connecttimeout":
+			if s.Origin.Source == "default" {
+				t.Errorf("%s: got default origin for configured keyword", s.Keyword)
+			}
+		case "port", "kexalgorithms":
+			if s.Origin.Source != "default" {
+				t.Errorf("%s: got %q origin, want default", s.Keyword, s.Origin)
+			}
+			if s.Value == "" {
+				t.Errorf("%s: missing default value", s.Keyword)
+			}
+		}
+	}
+}
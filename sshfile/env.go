@@ -0,0 +1,200 @@
+package sshfile
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/glaucusio/ssh"
+)
+
+// EnvPrefix is the prefix of environment variables read by ParseEnv.
+const EnvPrefix = "GOSSH_"
+
+var envKeys = []string{"HOSTNAME", "USER", "PORT", "IDENTITY", "OPTIONS"}
+
+func ParseEnv(environ []string) (Configs, error) {
+	return DefaultParser.ParseEnv(environ)
+}
+
+func EnvCallback() ssh.ConfigCallback {
+	return DefaultParser.EnvCallback()
+}
+
+// ParseEnv builds configs from environment variables given in the form
+// returned by os.Environ:
+//
+//	GOSSH_HOSTNAME, GOSSH_USER, GOSSH_PORT - HostName, User and Port
+//	GOSSH_IDENTITY                         - IdentityFile, a list of paths
+//	GOSSH_OPTIONS                          - Keyword=value options, optionally preceded by -o
+//
+// The variables apply to every host, unless they are given per host as
+// GOSSH_HOST_<NAME>_USER and so on, where <NAME> is the host name in upper
+// case with characters other than letters and digits replaced with '_'.
+// The per-host variables take precedence over the global ones.
+func (p *Parser) ParseEnv(environ []string) (Configs, error) {
+	var (
+		global = make(map[string]string)
+		hosts  = make(map[string]map[string]string)
+	)
+
+	for _, kv := range environ {
+		i := strings.IndexRune(kv, '=')
+		if i == -1 || !strings.HasPrefix(kv[:i], EnvPrefix) {
+			continue
+		}
+
+		name, v := kv[len(EnvPrefix):i], kv[i+1:]
+
+		if rest := strings.TrimPrefix(name, "HOST_"); rest != name {
+			host, key := splitEnvKey(rest)
+			if host == "" {
+				return nil, fmt.Errorf("unexpected %s%s variable: unknown key", EnvPrefix, name)
+			}
+
+			if hosts[host] == nil {
+				hosts[host] = make(map[string]string)
+			}
+
+			hosts[host][key] = v
+			continue
+		}
+
+		for _, key := range envKeys {
+			if name == key {
+				global[key] = v
+			}
+		}
+	}
+
+	var configs Configs
+
+	names := make([]string, 0, len(hosts))
+	for name := range hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cfg, err := p.env(hosts[name], EnvPrefix+"HOST_"+name+"_")
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.Host = envHost(name)
+
+		configs = append(configs, cfg)
+	}
+
+	if len(global) != 0 {
+		cfg, err := p.env(global, EnvPrefix)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.Host = allHosts
+
+		configs = append(configs, cfg)
+	}
+
+	return configs, nil
+}
+
+// EnvCallback returns a callback that resolves hosts with the configs
+// built from the environment, which is read on every call.
+func (p *Parser) EnvCallback() ssh.ConfigCallback {
+	return func(ctx context.Context, network, address string) (*ssh.Config, error) {
+		configs, err := p.ParseEnv(os.Environ())
+		if err != nil {
+			return nil, err
+		}
+
+		return configs.Callback()(ctx, network, address)
+	}
+}
+
+func (p *Parser) env(vars map[string]string, prefix string) (*Config, error) {
+	var options, sources []string
+
+	add := func(option, key string) {
+		options = append(options, option)
+		sources = append(sources, "environment variable "+prefix+key)
+	}
+
+	for _, opt := range []struct{ key, keyword string }{
+		{"HOSTNAME", "HostName"},
+		{"USER", "User"},
+		{"PORT", "Port"},
+	} {
+		if v, ok := vars[opt.key]; ok && v != "" {
+			add(opt.keyword+"="+v, opt.key)
+		}
+	}
+
+	for _, path := range filepath.SplitList(vars["IDENTITY"]) {
+		if path != "" {
+			add("IdentityFile="+path, "IDENTITY")
+		}
+	}
+
+	args, err := SplitArgs(vars["OPTIONS"])
+	if err != nil {
+		return nil, fmt.Errorf("unexpected %sOPTIONS variable: %w", prefix, err)
+	}
+
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "-o":
+			if i++; i == len(args) {
+				return nil, fmt.Errorf("unexpected %sOPTIONS variable: missing option after -o", prefix)
+			}
+			add(args[i], "OPTIONS")
+		case strings.HasPrefix(arg, "-o"):
+			add(arg[2:], "OPTIONS")
+		default:
+			add(arg, "OPTIONS")
+		}
+	}
+
+	cfg, err := p.parseOptions(options, sources)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected %s variables: %w", strings.TrimSuffix(prefix, "_"), err)
+	}
+
+	return cfg, nil
+}
+
+// splitEnvKey splits the name of per-host variable into the host name
+// and the key, or returns empty strings if the key is not known.
+func splitEnvKey(name string) (host, key string) {
+	for _, key := range envKeys {
+		if host := strings.TrimSuffix(name, "_"+key); host != name && host != "" {
+			return host, key
+		}
+	}
+	return "", ""
+}
+
+// envHost returns a pattern that matches the hosts whose names are
+// encoded as the given environment variable name.
+func envHost(name string) Host {
+	var buf strings.Builder
+
+	buf.WriteString("(?i)^")
+
+	for _, r := range name {
+		if r == '_' {
+			buf.WriteString("[^0-9a-z]")
+		} else {
+			buf.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	buf.WriteString("$")
+
+	return Host{Regexp: regexp.MustCompile(buf.String())}
+}
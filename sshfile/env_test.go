@@ -0,0 +1,113 @@
+package sshfile_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/glaucusio/ssh"
+	"github.com/glaucusio/ssh/sshfile"
+	"github.com/glaucusio/xerrors"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestParseEnv(t *testing.T) {
+	environ := []string{
+		"HOME=/home/ci",
+		"GOSSH_USER=ci",
+		"GOSSH_IDENTITY=/secrets/id_ci:/secrets/id_deploy",
+		"GOSSH_OPTIONS=-o StrictHostKeyChecking=accept-new Compression=yes",
+		"GOSSH_HOST_WEB_1_EXAMPLE_COM_HOSTNAME=10.0.0.1",
+		"GOSSH_HOST_WEB_1_EXAMPLE_COM_PORT=2222",
+		"GOSSH_HOST_BASTION_USER=admin",
+		"GOSSH_HOST_BASTION_OPTIONS=-oProxyCommand='nc %h %p' ServerAliveInterval=30",
+	}
+
+	tests := map[string]*sshfile.Config{
+		"web-1.example.com": {
+			Hostname:              "10.0.0.1",
+			Port:                  2222,
+			User:                  "ci",
+			IdentityFile:          sshfile.Strings{"/secrets/id_ci", "/secrets/id_deploy"},
+			StrictHostKeyChecking: sshfile.HostKeyCheckingAcceptNew,
+			Compression:           sshfile.Boolean(true),
+		},
+		"bastion": {
+			User:                  "admin",
+			ProxyCommand:          "nc %h %p",
+			ServerAliveInterval:   sshfile.Duration(30 * time.Second),
+			IdentityFile:          sshfile.Strings{"/secrets/id_ci", "/secrets/id_deploy"},
+			StrictHostKeyChecking: sshfile.HostKeyCheckingAcceptNew,
+			Compression:           sshfile.Boolean(true),
+		},
+		"db": {
+			User:                  "ci",
+			IdentityFile:          sshfile.Strings{"/secrets/id_ci", "/secrets/id_deploy"},
+			StrictHostKeyChecking: sshfile.HostKeyCheckingAcceptNew,
+			Compression:           sshfile.Boolean(true),
+		},
+	}
+
+	configs, err := sshfile.ParseEnv(environ)
+	if err != nil {
+		t.Fatalf("ParseEnv()=%s", err)
+	}
+
+	ignore := cmpopts.IgnoreFields(sshfile.Config{}, "Origins", "Host")
+
+	for host, want := range tests {
+		got, err := configs.Lookup(context.Background(), host)
+		if err != nil {
+			t.Fatalf("Lookup(%q)=%s", host, err)
+		}
+
+		if !cmp.Equal(got, want, ignore) {
+			t.Fatalf("%s: got != want:\n%s\n", host, cmp.Diff(got, want, ignore))
+		}
+	}
+
+	got, err := configs.Lookup(context.Background(), "web-1.example.com")
+	if err != nil {
+		t.Fatalf("Lookup()=%s", err)
+	}
+
+	if origin, want := got.Origins["port"].Source, "environment variable GOSSH_HOST_WEB_1_EXAMPLE_COM_PORT"; origin != want {
+		t.Fatalf("got %q, want %q", origin, want)
+	}
+}
+
+func TestParseEnvErrors(t *testing.T) {
+	for _, environ := range [][]string{
+		{"GOSSH_HOST_WEB_SHELL=bash"},
+		{"GOSSH_OPTIONS=-o"},
+		{"GOSSH_OPTIONS=Compression='yes"},
+		{"GOSSH_PORT=ssh"},
+		{"GOSSH_HOST_WEB_OPTIONS=Port=http"},
+	} {
+		if _, err := sshfile.ParseEnv(environ); err == nil {
+			t.Errorf("%q: expected error", environ)
+		}
+	}
+}
+
+func TestEnvCallback(t *testing.T) {
+	cb := sshfile.EnvCallback()
+
+	if _, err := cb(context.Background(), "tcp", "web-1:22"); !xerrors.Is(err, ssh.ErrConfigNotFound) {
+		t.Fatalf("got %v, want %v", err, ssh.ErrConfigNotFound)
+	}
+
+	os.Setenv("GOSSH_HOST_WEB_1_USER", "deploy")
+	defer os.Unsetenv("GOSSH_HOST_WEB_1_USER")
+
+	cfg, err := cb(context.Background(), "tcp", "web-1:22")
+	if err != nil {
+		t.Fatalf("Callback()=%s", err)
+	}
+
+	if cfg.User != "deploy" {
+		t.Fatalf("got %q, want %q", cfg.User, "deploy")
+	}
+}
@@ -0,0 +1,267 @@
+package sshfile
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Tokens allowed in the keywords, as documented in the TOKENS section
+// of ssh_config(5).
+const (
+	tokensHostname = "h"
+	tokensProxy    = "hnpr"
+	tokensFile     = "CdhijkLlnpru"
+	tokensCommand  = "CdhijkLlnpruT"
+)
+
+type tokens map[byte]string
+
+func (c *Config) tokens(host string) tokens {
+	t := tokens{
+		'n': host,
+		'h': host,
+		'r': c.User,
+		'j': c.ProxyJump,
+		'k': host,
+		'p': "22",
+		'T': "NONE",
+	}
+
+	if c.Hostname != "" {
+		t['h'] = c.Hostname
+	}
+
+	if c.HostKeyAlias != "" {
+		t['k'] = c.HostKeyAlias
+	}
+
+	if c.Port != 0 {
+		t['p'] = strconv.Itoa(c.Port)
+	}
+
+	if u, err := user.Current(); err == nil {
+		t['d'], t['u'], t['i'] = u.HomeDir, u.Username, u.Uid
+
+		if t['r'] == "" {
+			t['r'] = u.Username
+		}
+	}
+
+	if name, err := os.Hostname(); err == nil {
+		t['l'] = name
+
+		if i := strings.IndexRune(name, '.'); i != -1 {
+			name = name[:i]
+		}
+
+		t['L'] = name
+	}
+
+	sum := sha1.Sum([]byte(t['l'] + t['h'] + t['p'] + t['r'] + t['j']))
+	t['C'] = hex.EncodeToString(sum[:])
+
+	return t
+}
+
+// Expand returns a copy of the config with the tokens, environment
+// variables and tilde prefixes expanded for the given original host.
+func (c *Config) Expand(host string) (*Config, error) {
+	c = c.clone()
+
+	var err error
+
+	if c.Hostname, err = expand(c.Hostname, tokens{'h': host}, tokensHostname, false); err != nil {
+		return nil, fmt.Errorf("failed to expand hostname: %w", err)
+	}
+
+	t := c.tokens(host)
+
+	for _, f := range c.expansions() {
+		for _, value := range f.values {
+			if *value == "" {
+				continue
+			}
+
+			if f.tilde {
+				if *value, err = expandTilde(*value, nil); err != nil {
+					return nil, fmt.Errorf("failed to expand %s: %w", f.keyword, err)
+				}
+			}
+
+			if *value, err = expand(*value, t, f.tokens, f.env); err != nil {
+				return nil, fmt.Errorf("failed to expand %s: %w", f.keyword, err)
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// expansion describes how the values of a keyword are expanded.
+type expansion struct {
+	keyword string
+	values  []*string
+	tokens  string
+	env     bool
+	tilde   bool
+}
+
+func (c *Config) expansions() []expansion {
+	return []expansion{
+		{"certificatefile", c.CertificateFile.ptrs(), tokensFile, true, true},
+		{"controlpath", ptrs(&c.ControlPath), tokensFile, true, true},
+		{"globalknownhostsfile", c.GlobalKnownHostsFile.ptrs(), "", false, true},
+		{"identityagent", ptrs(&c.IdentityAgent), tokensFile, true, true},
+		{"identityfile", c.IdentityFile.ptrs(), tokensFile, true, true},
+		{"knownhostscommand", ptrs(&c.KnownHostsCommand), tokensFile, true, false},
+		{"localcommand", ptrs(&c.LocalCommand), tokensCommand, false, false},
+		{"localforward", ptrs(&c.LocalForward), tokensFile, true, false},
+		{"proxycommand", ptrs(&c.ProxyCommand), tokensProxy, false, false},
+		{"proxyjump", ptrs(&c.ProxyJump), tokensProxy, false, false},
+		{"remotecommand", ptrs(&c.RemoteCommand), tokensFile, false, false},
+		{"remoteforward", ptrs(&c.RemoteForward), tokensFile, true, false},
+		{"revokedhostkeys", ptrs(&c.RevokedHostKeys), tokensFile, true, true},
+		{"userknownhostsfile", c.UserKnownHostsFile.ptrs(), tokensFile, true, true},
+	}
+}
+
+// expandUser expands the tilde prefixes and the tokens of the local user,
+// leaving the rest to Expand.
+func (c *Config) expandUser(u *user.User) error {
+	t := tokens{'d': u.HomeDir, 'u': u.Username, 'i': u.Uid}
+
+	for _, f := range c.expansions() {
+		for _, value := range f.values {
+			if *value == "" {
+				continue
+			}
+
+			if f.tilde {
+				var err error
+				if *value, err = expandTilde(*value, u); err != nil {
+					return fmt.Errorf("failed to expand %s: %w", f.keyword, err)
+				}
+			}
+
+			*value = expandTokens(*value, t, f.tokens)
+		}
+	}
+
+	return nil
+}
+
+func ptrs(s ...*string) []*string {
+	return s
+}
+
+func expand(s string, t tokens, allowed string, env bool) (string, error) {
+	if !strings.ContainsAny(s, "%$") {
+		return s, nil
+	}
+
+	var buf strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '%' && allowed != "":
+			if i++; i == len(s) {
+				return "", fmt.Errorf("invalid trailing %% in %q", s)
+			}
+
+			if s[i] == '%' {
+				buf.WriteByte('%')
+				continue
+			}
+
+			v, ok := t[s[i]]
+			if !ok || !strings.ContainsRune(allowed, rune(s[i])) {
+				return "", fmt.Errorf("unknown token %%%c in %q", s[i], s)
+			}
+
+			buf.WriteString(v)
+		case s[i] == '$' && env && strings.HasPrefix(s[i:], "${"):
+			j := strings.IndexRune(s[i:], '}')
+			if j == -1 {
+				return "", fmt.Errorf("unterminated environment variable in %q", s)
+			}
+
+			name := s[i+2 : i+j]
+
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				return "", fmt.Errorf("environment variable ${%s} is not set", name)
+			}
+
+			buf.WriteString(v)
+
+			i += j
+		default:
+			buf.WriteByte(s[i])
+		}
+	}
+
+	return buf.String(), nil
+}
+
+// expandTokens expands the given tokens only, the other ones and the %%
+// escapes are kept for expand.
+func expandTokens(s string, t tokens, allowed string) string {
+	if !strings.ContainsRune(s, '%') {
+		return s
+	}
+
+	var buf strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+1 == len(s) {
+			buf.WriteByte(s[i])
+			continue
+		}
+
+		i++
+
+		if v, ok := t[s[i]]; ok && strings.IndexByte(allowed, s[i]) != -1 {
+			buf.WriteString(v)
+		} else {
+			buf.WriteByte('%')
+			buf.WriteByte(s[i])
+		}
+	}
+
+	return buf.String()
+}
+
+// expandTilde replaces the ~ or ~user prefix with the home directory
+// of the user, where ~ refers to u, or to the current user if u is nil.
+func expandTilde(s string, u *user.User) (string, error) {
+	if !strings.HasPrefix(s, "~") {
+		return s, nil
+	}
+
+	name, rest := s[1:], ""
+
+	if i := strings.IndexRune(name, '/'); i != -1 {
+		name, rest = name[:i], name[i+1:]
+	}
+
+	var err error
+
+	switch {
+	case name != "":
+		u, err = user.Lookup(name)
+	case u == nil:
+		u, err = user.Current()
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to lookup user for %q: %w", s, err)
+	}
+
+	return filepath.Join(u.HomeDir, rest), nil
+}
@@ -0,0 +1,190 @@
+package sshfile
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/glaucusio/ssh"
+	xssh "golang.org/x/crypto/ssh"
+)
+
+// pathKeywords take a single path, which must be quoted if it contains
+// whitespace.
+var pathKeywords = map[string]struct{}{
+	"certificatefile":     {},
+	"controlpath":         {},
+	"identityagent":       {},
+	"identityfile":        {},
+	"pkcs11provider":      {},
+	"revokedhostkeys":     {},
+	"securitykeyprovider": {},
+	"xauthlocation":       {},
+}
+
+// Args returns ssh command line options equivalent to the config, in the
+// form of "-o Keyword=value" pairs, which can be passed to ssh or to tools
+// wrapping it, like rsync -e or GIT_SSH_COMMAND.
+func (c *Config) Args() []string {
+	var args []string
+
+	for _, s := range c.options() {
+		args = append(args, "-o", s.Keyword+"="+s.Value)
+	}
+
+	return args
+}
+
+// File returns a standalone ssh_config file with a single Host block for
+// the given host, holding all the settings of the config.
+func (c *Config) File(host string) *File {
+	f := &File{
+		Global:  new(Block),
+		eol:     "\n",
+		lastEOL: true,
+	}
+
+	b := f.AddHost(host)
+
+	for _, s := range c.options() {
+		b.Add(s.Keyword, s.Value)
+	}
+
+	return f
+}
+
+// options returns the settings of the config with canonical keyword names
+// and values quoted as needed.
+func (c *Config) options() []Setting {
+	settings := c.Settings()
+
+	for i, s := range settings {
+		if _, ok := pathKeywords[s.Keyword]; ok && strings.ContainsAny(s.Value, " \t") {
+			settings[i].Value = `"` + s.Value + `"`
+		}
+
+		if name, ok := keywordNames[s.Keyword]; ok {
+			settings[i].Keyword = name
+		}
+	}
+
+	return settings
+}
+
+// Options returns the options equivalent to the settings of the config
+// that have one, like User, Port, IdentityFile or ProxyJump. The identity
+// files are expanded, and the ones that can not be read are skipped.
+func (c *Config) Options() []ssh.Option {
+	var opts []ssh.Option
+
+	if c.User != "" {
+		opts = append(opts, ssh.WithUser(c.User))
+	}
+
+	if c.Port != 0 {
+		opts = append(opts, ssh.WithPort(c.Port))
+	}
+
+	if c.ConnectTimeout != 0 {
+		opts = append(opts, ssh.WithTimeout(c.ConnectTimeout.Duration()))
+	}
+
+	if len(c.IdentityFile) != 0 {
+		opts = append(opts, &identityOption{
+			files:   c.identityFiles(),
+			options: ssh.ConfigOptions(ssh.WithIdentityFiles(c.IdentityFile...)),
+		})
+	}
+
+	if c.ProxyJump != "" {
+		opts = append(opts, ssh.WithJump(jumpHosts(c.ProxyJump)...))
+	}
+
+	if c.ServerAliveInterval != 0 {
+		opts = append(opts, ssh.WithHeartbeat(c.ServerAliveInterval.Duration(), c.ServerAliveCountMax))
+	}
+
+	if c.TcpKeepAlive != nil {
+		opts = append(opts, ssh.WithKeepAlive(c.TcpKeepAlive.Bool()))
+	}
+
+	algs := ssh.Algorithms{
+		Ciphers:      algorithms(c.Ciphers, defaultAlgorithms.Ciphers),
+		MACs:         algorithms(c.MACs, defaultAlgorithms.MACs),
+		KeyExchanges: algorithms(c.KexAlgorithms, defaultAlgorithms.KeyExchanges),
+		HostKeys:     algorithms(c.HostKeyAlgorithms, defaultHostKeyAlgorithms),
+	}
+
+	if len(algs.Ciphers)+len(algs.MACs)+len(algs.KeyExchanges)+len(algs.HostKeys) != 0 {
+		opts = append(opts, ssh.WithAlgorithms(algs))
+	}
+
+	return opts
+}
+
+// identityOption adds public key auth with the identity files, skipping
+// the ones that are missing or can not be used, like the client does.
+type identityOption struct {
+	files   []string
+	options []string
+}
+
+func (o *identityOption) Apply(cfg *ssh.Config) *ssh.Config {
+	return cfg.WithAuth(xssh.PublicKeysCallback(func() ([]xssh.Signer, error) {
+		signers, err := identitySigners(o.files...)
+		if errors.Is(err, NoAuthMethods) {
+			return nil, nil
+		}
+		return signers, err
+	}))
+}
+
+func (o *identityOption) ConfigOptions() []string {
+	return o.options
+}
+
+// identityFiles returns the identity files with the tokens, environment
+// variables and tilde prefixes expanded like Expand does, leaving the ones
+// that fail to expand as they are.
+func (c *Config) identityFiles() []string {
+	t := c.tokens(c.Hostname)
+	files := make([]string, 0, len(c.IdentityFile))
+
+	for _, file := range c.IdentityFile {
+		if s, err := expandTilde(file, nil); err == nil {
+			file = s
+		}
+
+		if s, err := expand(file, t, tokensFile, true); err == nil {
+			file = s
+		}
+
+		files = append(files, file)
+	}
+
+	return files
+}
+
+func FromOptions(opts ...ssh.Option) (*Config, error) {
+	return DefaultParser.FromOptions(opts...)
+}
+
+// FromOptions returns the config equivalent to the options, skipping
+// the ones that have no ssh_config equivalent, like WithHostKeyCallback.
+func (p *Parser) FromOptions(opts ...ssh.Option) (*Config, error) {
+	options := ssh.ConfigOptions(opts...)
+	sources := make([]string, len(options))
+
+	for i := range sources {
+		sources[i] = "option"
+	}
+
+	return p.parseOptions(options, sources)
+}
+
+// jumpHosts splits the ProxyJump value into the list of destinations.
+func jumpHosts(spec string) []string {
+	if spec == "" || strings.EqualFold(spec, "none") {
+		return nil
+	}
+	return strings.Split(spec, ",")
+}
@@ -0,0 +1,159 @@
+package sshfile
+
+import (
+	"io"
+	"reflect"
+	"strings"
+)
+
+var keywordNames = func() map[string]string {
+	m := map[string]string{
+		"host":         "Host",
+		"match":        "Match",
+		"include":      "Include",
+		"hostname":     "HostName",
+		"tcpkeepalive": "TCPKeepAlive",
+	}
+
+	typ := reflect.TypeOf(Config{})
+
+	for i := 0; i < typ.NumField(); i++ {
+		k := strings.ToLower(typ.Field(i).Name)
+		if _, ok := keywords[k]; !ok {
+			continue
+		}
+		if _, ok := m[k]; !ok {
+			m[k] = typ.Field(i).Name
+		}
+	}
+
+	return m
+}()
+
+// Format reads ssh_config content from r and returns it formatted with
+// Format method of File.
+func Format(r io.Reader) ([]byte, error) {
+	f, err := ParseFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	f.Format()
+
+	return f.Bytes(), nil
+}
+
+// section is a Host or Match block together with the comments
+// preceding its header.
+type section struct {
+	comments []*Line
+	block    *Block
+}
+
+// Format normalizes the file in place: keywords are written in their
+// canonical casing and separated from values with a single space, lines
+// of Host and Match blocks are indented with a tab, consecutive blank
+// lines are collapsed and blocks are separated with a single blank line.
+// Comments preceding a block header are kept together with the header.
+// Neither the order of keywords nor comments are changed.
+func (f *File) Format() {
+	global, comments := splitComments(f.Global.Lines, len(f.Blocks) != 0)
+	sections := make([]section, 0, len(f.Blocks))
+
+	for i, b := range f.Blocks {
+		sections = append(sections, section{comments: comments, block: b})
+		b.Lines, comments = splitComments(b.Lines, i != len(f.Blocks)-1)
+	}
+
+	f.Global.Lines = formatLines(global, "")
+
+	prev := f.Global
+
+	for _, s := range sections {
+		if len(prev.Lines) != 0 || prev != f.Global {
+			prev.Lines = append(prev.Lines, &Line{})
+		}
+
+		prev.Lines = append(prev.Lines, formatLines(s.comments, "")...)
+
+		formatLine(s.block.Header, "")
+		s.block.Lines = formatLines(s.block.Lines, "\t")
+
+		prev = s.block
+	}
+
+	f.lastEOL = true
+}
+
+// splitComments trims blank lines surrounding the lines and, if next is true,
+// splits off the trailing comments, which belong to the next block
+// header when they are separated from the preceding lines with a blank
+// line or they are not indented.
+func splitComments(lines []*Line, next bool) (body, comments []*Line) {
+	lines = trimBlank(lines)
+
+	if !next {
+		return lines, nil
+	}
+
+	i := len(lines)
+	for i > 0 && lines[i-1].IsComment() && !lines[i-1].isBlank() {
+		i--
+	}
+
+	if i == len(lines) {
+		return lines, nil
+	}
+
+	if i == 0 || lines[i-1].isBlank() || lines[i].Indent == "" {
+		return trimBlank(lines[:i]), lines[i:]
+	}
+
+	return lines, nil
+}
+
+func trimBlank(lines []*Line) []*Line {
+	for len(lines) != 0 && lines[0].isBlank() {
+		lines = lines[1:]
+	}
+	for len(lines) != 0 && lines[len(lines)-1].isBlank() {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func formatLines(lines []*Line, indent string) []*Line {
+	var formatted []*Line
+
+	for i, l := range lines {
+		if l.isBlank() {
+			if i != 0 && !lines[i-1].isBlank() {
+				formatted = append(formatted, &Line{})
+			}
+			continue
+		}
+
+		formatLine(l, indent)
+		formatted = append(formatted, l)
+	}
+
+	return formatted
+}
+
+func formatLine(l *Line, indent string) {
+	l.Indent, l.Raw, l.eol = indent, "", ""
+
+	if l.Keyword == "" {
+		return
+	}
+
+	if name, ok := keywordNames[strings.ToLower(l.Keyword)]; ok {
+		l.Keyword = name
+	}
+
+	if l.Value != "" {
+		l.Sep = " "
+	} else {
+		l.Sep = ""
+	}
+}
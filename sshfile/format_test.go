@@ -0,0 +1,77 @@
+package sshfile_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/glaucusio/ssh/sshfile"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFormat(t *testing.T) {
+	const config = `
+
+user=admin
+  connecttimeout   60
+
+
+# the bastion
+host bastion
+    hostname=10.0.0.1
+
+
+    identityfile ~/.ssh/id_bastion
+    # inner comment
+Host old
+	USER nobody
+	# trailing comment of old
+
+# catch all
+Host *
+ServerAliveInterval 60
+tcpkeepalive yes
+Bogus   1
+
+
+`
+
+	const want = `User admin
+ConnectTimeout 60
+
+# the bastion
+Host bastion
+	HostName 10.0.0.1
+
+	IdentityFile ~/.ssh/id_bastion
+	# inner comment
+
+Host old
+	User nobody
+	# trailing comment of old
+
+# catch all
+Host *
+	ServerAliveInterval 60
+	TCPKeepAlive yes
+	Bogus 1
+`
+
+	got, err := sshfile.Format(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("Format()=%s", err)
+	}
+
+	if string(got) != want {
+		t.Fatalf("got != want:\n%s", cmp.Diff(string(got), want))
+	}
+
+	again, err := sshfile.Format(bytes.NewReader(got))
+	if err != nil {
+		t.Fatalf("Format()=%s", err)
+	}
+
+	if !bytes.Equal(again, got) {
+		t.Fatalf("Format() is not idempotent:\n%s", cmp.Diff(string(again), string(got)))
+	}
+}
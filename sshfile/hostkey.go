@@ -0,0 +1,82 @@
+package sshfile
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	xssh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// knownHosts returns a callback verifying host keys against the known hosts
+// files, or nil if the config names no files. If none of the files exist,
+// all the keys are unknown. With StrictHostKeyChecking accept-new, keys of
+// unknown hosts are added to the first user file, which is created on the
+// first write.
+func (c *Config) knownHosts() (xssh.HostKeyCallback, error) {
+	all := append(c.UserKnownHostsFile.clone(), c.GlobalKnownHostsFile...)
+	if len(all) == 0 {
+		return nil, nil
+	}
+
+	var files []string
+
+	for _, file := range all {
+		if _, err := os.Stat(file); err == nil {
+			files = append(files, file)
+		}
+	}
+
+	known := unknownHosts(all)
+
+	if len(files) != 0 {
+		var err error
+		if known, err = knownhosts.New(files...); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.StrictHostKeyChecking == HostKeyCheckingAcceptNew && len(c.UserKnownHostsFile) != 0 {
+		return acceptNew(known, c.UserKnownHostsFile[0]), nil
+	}
+
+	return known, nil
+}
+
+// unknownHosts returns a host key callback for missing known hosts files,
+// which knows no hosts.
+func unknownHosts(files []string) xssh.HostKeyCallback {
+	return func(hostname string, _ net.Addr, _ xssh.PublicKey) error {
+		return fmt.Errorf("unable to verify host key of %q, no known hosts files exist (%s): %w",
+			hostname, strings.Join(files, ", "), &knownhosts.KeyError{})
+	}
+}
+
+// acceptNew returns a host key callback which adds keys of hosts that are
+// not yet known to the given file, while still refusing changed keys.
+func acceptNew(known xssh.HostKeyCallback, file string) xssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key xssh.PublicKey) error {
+		err := known(hostname, remote, key)
+
+		var kerr *knownhosts.KeyError
+		if !errors.As(err, &kerr) || len(kerr.Want) != 0 {
+			return err
+		}
+
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open %q: %w", file, err)
+		}
+
+		_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+
+		if err := nonil(err, f.Close()); err != nil {
+			return fmt.Errorf("failed to add host key to %q: %w", file, err)
+		}
+
+		return nil
+	}
+}
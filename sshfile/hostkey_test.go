@@ -0,0 +1,89 @@
+package sshfile_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/glaucusio/ssh/sshfile"
+	xssh "golang.org/x/crypto/ssh"
+)
+
+func TestConfigKnownHosts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshfile")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	newKey := func() xssh.PublicKey {
+		t.Helper()
+
+		pub, _, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("GenerateKey()=%s", err)
+		}
+
+		key, err := xssh.NewPublicKey(pub)
+		if err != nil {
+			t.Fatalf("NewPublicKey()=%s", err)
+		}
+
+		return key
+	}
+
+	file := filepath.Join(dir, "known_hosts")
+	remote := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 22}
+
+	callback := func(checking string) xssh.HostKeyCallback {
+		t.Helper()
+
+		config := "Host web\n\tStrictHostKeyChecking " + checking + "\n\tUserKnownHostsFile " + file + "\n"
+
+		cfgs, err := (&sshfile.Parser{}).ParseConfig(strings.NewReader(config))
+		if err != nil {
+			t.Fatalf("ParseConfig()=%s", err)
+		}
+
+		cfg, err := cfgs.Callback()(context.Background(), "tcp", "web")
+		if err != nil {
+			t.Fatalf("Callback()=%s", err)
+		}
+
+		if cfg.HostKeyCallback == nil {
+			t.Fatal("missing host key callback")
+		}
+
+		return cfg.HostKeyCallback
+	}
+
+	key := newKey()
+
+	if err := callback("yes")("web:22", remote, key); err == nil {
+		t.Fatal("expected unknown host key to be refused")
+	}
+
+	known := callback("accept-new")
+
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("known hosts file was created before connecting: %v", err)
+	}
+
+	if err := known("web:22", remote, key); err != nil {
+		t.Fatalf("HostKeyCallback()=%s", err)
+	}
+
+	if err := callback("yes")("web:22", remote, key); err != nil {
+		t.Fatalf("HostKeyCallback()=%s", err)
+	}
+
+	if err := callback("accept-new")("web:22", remote, newKey()); err == nil {
+		t.Fatal("expected changed host key to be refused")
+	}
+}
@@ -0,0 +1,397 @@
+package sshfile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/glaucusio/ssh"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Inventory is a set of host definitions kept in a YAML or JSON file:
+//
+//	defaults:
+//	  User: deploy
+//	groups:
+//	  base:
+//	    IdentityFile: ~/.ssh/id_deploy
+//	  web:
+//	    groups: [base]
+//	    Port: 2222
+//	hosts:
+//	  - host: bastion
+//	    HostName: 10.0.0.1
+//	  - host: web-* www
+//	    groups: [web]
+//
+// Keys other than host and groups are ssh_config keywords. Hosts are
+// matched in the order they are listed and inherit settings from their
+// groups, in the order the groups are listed, and from the defaults,
+// which apply to every host.
+type Inventory struct {
+	Defaults map[string]interface{}            `json:"defaults,omitempty" yaml:"defaults,omitempty"`
+	Groups   map[string]map[string]interface{} `json:"groups,omitempty" yaml:"groups,omitempty"`
+	Hosts    []map[string]interface{}          `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+}
+
+func ParseInventoryFile(path string) (Configs, error) {
+	return DefaultParser.ParseInventoryFile(path)
+}
+
+func ParseYAML(r io.Reader) (Configs, error) {
+	return DefaultParser.ParseYAML(r)
+}
+
+func ParseJSON(r io.Reader) (Configs, error) {
+	return DefaultParser.ParseJSON(r)
+}
+
+func InventoryCallback(path string) ssh.ConfigCallback {
+	return DefaultParser.InventoryCallback(path)
+}
+
+// ParseInventoryFile parses inventory file, which is expected to be in JSON
+// format if it has .json extension and in YAML format otherwise.
+func (p *Parser) ParseInventoryFile(path string) (Configs, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var inv Inventory
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = decodeJSON(f, &inv)
+	} else {
+		err = decodeYAML(f, &inv)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", path, err)
+	}
+
+	return p.inventory(&inv, path)
+}
+
+// InventoryCallback returns a callback that resolves hosts with the configs
+// built from the inventory file, which is read on every call.
+func (p *Parser) InventoryCallback(path string) ssh.ConfigCallback {
+	return func(ctx context.Context, network, address string) (*ssh.Config, error) {
+		configs, err := p.ParseInventoryFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		return configs.Callback()(ctx, network, address)
+	}
+}
+
+func (p *Parser) ParseYAML(r io.Reader) (Configs, error) {
+	var inv Inventory
+
+	if err := decodeYAML(r, &inv); err != nil {
+		return nil, err
+	}
+
+	return p.inventory(&inv, "")
+}
+
+func (p *Parser) ParseJSON(r io.Reader) (Configs, error) {
+	var inv Inventory
+
+	if err := decodeJSON(r, &inv); err != nil {
+		return nil, err
+	}
+
+	return p.inventory(&inv, "")
+}
+
+func decodeYAML(r io.Reader, inv *Inventory) error {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+
+	if err := dec.Decode(inv); err != nil && err != io.EOF {
+		return err
+	}
+
+	return nil
+}
+
+func decodeJSON(r io.Reader, inv *Inventory) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	dec.UseNumber()
+
+	return dec.Decode(inv)
+}
+
+func (p *Parser) inventory(inv *Inventory, file string) (Configs, error) {
+	var (
+		configs Configs
+		groups  = make(map[string]*Config, len(inv.Groups))
+	)
+
+	for _, name := range sortedKeys(inv.Groups) {
+		if _, err := p.group(inv, name, file, groups, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, m := range inv.Hosts {
+		block := fmt.Sprintf("hosts[%d]", i)
+
+		s, err := p.parseEntry(m, file, block)
+		if err != nil {
+			return nil, err
+		}
+
+		if s.host == "" {
+			return nil, fmt.Errorf("%s: missing host", block)
+		}
+
+		hosts, err := parseHosts(s.host)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unexpected host: %w", block, err)
+		}
+
+		cfg, err := inherit(s, groups, block)
+		if err != nil {
+			return nil, err
+		}
+
+		if negated(s.host) {
+			cfg.Match = Match{{Keyword: "host", Arg: strings.Join(strings.Fields(s.host), ",")}}
+			hosts = []Host{{}}
+		}
+
+		configs = configs.append(cfg, hosts...)
+	}
+
+	s, err := p.parseEntry(inv.Defaults, file, "defaults")
+	if err != nil {
+		return nil, err
+	}
+
+	if s.host != "" || len(s.groups) != 0 {
+		return nil, errors.New("defaults: unexpected host or groups")
+	}
+
+	s.cfg.Host = allHosts
+	configs = append(configs, s.cfg)
+
+	return configs, p.finish(configs...)
+}
+
+func (p *Parser) group(inv *Inventory, name, file string, groups map[string]*Config, stack []string) (*Config, error) {
+	if cfg, ok := groups[name]; ok {
+		return cfg, nil
+	}
+
+	for _, parent := range stack {
+		if parent == name {
+			return nil, fmt.Errorf("group %q: inheritance cycle: %s", name, strings.Join(append(stack, name), " -> "))
+		}
+	}
+
+	m, ok := inv.Groups[name]
+	if !ok {
+		return nil, fmt.Errorf("group %q: not found", name)
+	}
+
+	block := "group " + name
+
+	s, err := p.parseEntry(m, file, block)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.host != "" {
+		return nil, fmt.Errorf("%s: unexpected host", block)
+	}
+
+	for _, parent := range s.groups {
+		if _, err := p.group(inv, parent, file, groups, append(stack, name)); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg, err := inherit(s, groups, block)
+	if err != nil {
+		return nil, err
+	}
+
+	groups[name] = cfg
+
+	return cfg, nil
+}
+
+// inherit returns the config of the entry merged with the configs of
+// its groups, where the entry takes precedence over the groups and
+// the earlier groups take precedence over the later ones.
+func inherit(s *entry, groups map[string]*Config, block string) (*Config, error) {
+	cfg := new(Config)
+
+	for i := len(s.groups) - 1; i >= 0; i-- {
+		g, ok := groups[s.groups[i]]
+		if !ok {
+			return nil, fmt.Errorf("%s: group %q not found", block, s.groups[i])
+		}
+
+		if err := cfg.Merge(g); err != nil {
+			return nil, fmt.Errorf("%s: %w", block, err)
+		}
+	}
+
+	if err := cfg.Merge(s.cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", block, err)
+	}
+
+	return cfg, nil
+}
+
+type entry struct {
+	cfg    *Config
+	host   string
+	groups []string
+}
+
+func (p *Parser) parseEntry(m map[string]interface{}, file, block string) (*entry, error) {
+	var (
+		s       = &entry{cfg: new(Config)}
+		tmp     = make(values)
+		origins = make(Origins)
+		keys    []string
+		ignore  string
+	)
+
+	for _, key := range sortedKeys(m) {
+		v := m[key]
+
+		switch strings.ToLower(key) {
+		case "host":
+			h, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: unexpected host: %v", block, v)
+			}
+			s.host = h
+		case "groups":
+			list, err := scalars(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: unexpected groups: %w", block, err)
+			}
+			s.groups = list
+		case "ignoreunknown":
+			ignore = fmt.Sprint(v)
+			keys = append(keys, key)
+		default:
+			keys = append(keys, key)
+		}
+	}
+
+	// Keywords are resolved once the whole entry is read, as its host and
+	// IgnoreUnknown apply to all of them, regardless of the order of keys.
+	origin := Origin{File: file, Block: block}
+	if s.host != "" {
+		origin.Block = "Host " + s.host
+	}
+
+	for _, key := range keys {
+		k, ok, err := p.keyword(key, 0, ignore)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", block, err)
+		}
+		if !ok {
+			continue
+		}
+
+		list, err := scalars(m[key])
+		if err != nil {
+			return nil, fmt.Errorf("%s: unexpected %s value: %w", block, key, err)
+		}
+
+		if _, ok := cumulativeKeywords[k]; ok {
+			for _, v := range list {
+				tmp.set(k, v)
+			}
+		} else {
+			tmp.set(k, strings.Join(list, " "))
+		}
+
+		origins[k] = origin
+	}
+
+	if err := merge(s.cfg, tmp); err != nil {
+		return nil, fmt.Errorf("%s: %w", block, err)
+	}
+
+	s.cfg.Origins.merge(origins)
+
+	return s, nil
+}
+
+// scalars converts a scalar or a list of scalars to strings, as they are
+// written in ssh_config.
+func scalars(v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, v := range v {
+			s, err := scalar(v)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	default:
+		s, err := scalar(v)
+		if err != nil {
+			return nil, err
+		}
+		return []string{s}, nil
+	}
+}
+
+func scalar(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		if v {
+			return "yes", nil
+		}
+		return "no", nil
+	case int, int64, uint64, float64, json.Number:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("unexpected value %v of type %T", v, v)
+	}
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+
+	switch m := m.(type) {
+	case map[string]interface{}:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]map[string]interface{}:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
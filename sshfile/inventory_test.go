@@ -0,0 +1,187 @@
+package sshfile_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glaucusio/ssh/sshfile"
+	"github.com/glaucusio/xerrors"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestParseInventoryFile(t *testing.T) {
+	tests := map[string]*sshfile.Config{
+		"bastion": {
+			Hostname:            "10.0.0.1",
+			User:                "admin",
+			ServerAliveInterval: sshfile.Duration(time.Minute),
+			IdentityFile:        sshfile.Strings{"~/.ssh/id_deploy"},
+		},
+		"web-1": {
+			Port:                  2222,
+			StrictHostKeyChecking: sshfile.HostKeyCheckingAcceptNew,
+			UserKnownHostsFile:    sshfile.Strings{"~/.ssh/known_hosts", "~/.ssh/known_hosts_web"},
+			Compression:           sshfile.Boolean(true),
+			User:                  "deploy",
+			ServerAliveInterval:   sshfile.Duration(time.Minute),
+			IdentityFile:          sshfile.Strings{"~/.ssh/id_web", "~/.ssh/id_deploy"},
+		},
+		"db": {
+			Port:                  2200,
+			StrictHostKeyChecking: sshfile.HostKeyCheckingAcceptNew,
+			User:                  "deploy",
+			ServerAliveInterval:   sshfile.Duration(time.Minute),
+			IdentityFile:          sshfile.Strings{"~/.ssh/id_deploy"},
+		},
+	}
+
+	ignore := cmpopts.IgnoreFields(sshfile.Config{}, "Origins", "Host")
+
+	for _, file := range []string{"testdata/inventory.yaml", "testdata/inventory.json"} {
+		t.Run(file, func(t *testing.T) {
+			configs, err := sshfile.ParseInventoryFile(file)
+			if err != nil {
+				t.Fatalf("ParseInventoryFile()=%s", err)
+			}
+
+			for host, want := range tests {
+				got, err := configs.Lookup(context.Background(), host)
+				if err != nil {
+					t.Fatalf("Lookup(%q)=%s", host, err)
+				}
+
+				if !cmp.Equal(got, want, ignore) {
+					t.Fatalf("%s: got != want:\n%s\n", host, cmp.Diff(got, want, ignore))
+				}
+			}
+
+			got, err := configs.Lookup(context.Background(), "web-1")
+			if err != nil {
+				t.Fatalf("Lookup()=%s", err)
+			}
+
+			if origin := got.Origins["port"]; origin.File != file || origin.Block != "group web" {
+				t.Fatalf("unexpected origin of port: %+v", origin)
+			}
+		})
+	}
+}
+
+func TestParseInventoryErrors(t *testing.T) {
+	for _, inv := range []string{
+		"groups:\n  a:\n    groups: [b]\n  b:\n    groups: [a]\n",
+		"hosts:\n  - host: web\n    groups: [missing]\n",
+		"hosts:\n  - User: admin\n",
+		"hosts:\n  - host: web\n    Port: [1, {a: b}]\n",
+		"inventory:\n  hosts: []\n",
+	} {
+		if _, err := sshfile.ParseYAML(strings.NewReader(inv)); err == nil {
+			t.Fatalf("ParseYAML(%q): expected error", inv)
+		}
+	}
+}
+
+func TestParseInventoryIgnoreUnknown(t *testing.T) {
+	p := &sshfile.Parser{Strict: true}
+
+	const inv = "hosts:\n  - host: web\n    Bogus: yes\n    IgnoreUnknown: bogus\n    User: admin\n"
+
+	configs, err := p.ParseYAML(strings.NewReader(inv))
+	if err != nil {
+		t.Fatalf("ParseYAML()=%s", err)
+	}
+
+	got, err := configs.Lookup(context.Background(), "web")
+	if err != nil {
+		t.Fatalf("Lookup()=%s", err)
+	}
+
+	if origin := got.Origins["user"]; origin.Block != "Host web" {
+		t.Fatalf("unexpected origin of user: %+v", origin)
+	}
+}
+
+func TestParseInventoryUser(t *testing.T) {
+	const inv = "defaults:\n  ControlPath: ~/.ssh/cm-%i\n" +
+		"hosts:\n  - host: web\n    IdentityFile: [~/.ssh/id_%u, /keys/id_web]\n"
+
+	var checked []string
+
+	p := &sshfile.Parser{
+		User: &user.User{Uid: "1001", Username: "bob", HomeDir: "/home/bob"},
+		Warn: func(error) {},
+		CheckFile: func(path string, private bool) error {
+			checked = append(checked, path)
+			if path == "/keys/id_web" {
+				return errors.New("bad permissions")
+			}
+			return nil
+		},
+	}
+
+	configs, err := p.ParseYAML(strings.NewReader(inv))
+	if err != nil {
+		t.Fatalf("ParseYAML()=%s", err)
+	}
+
+	got, err := configs.Lookup(context.Background(), "web")
+	if err != nil {
+		t.Fatalf("Lookup()=%s", err)
+	}
+
+	want := &sshfile.Config{
+		IdentityFile: sshfile.Strings{"/home/bob/.ssh/id_bob"},
+		ControlPath:  "/home/bob/.ssh/cm-1001",
+	}
+
+	opts := cmpopts.IgnoreFields(sshfile.Config{}, "Host", "Origins")
+
+	if !cmp.Equal(got, want, opts) {
+		t.Fatalf("got != want:\n%s\n", cmp.Diff(got, want, opts))
+	}
+
+	if want := []string{"/home/bob/.ssh/id_bob", "/keys/id_web"}; !cmp.Equal(checked, want) {
+		t.Errorf("checked != want:\n%s\n", cmp.Diff(checked, want))
+	}
+}
+
+func TestInventoryCallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshfile")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "inventory.yaml")
+
+	cb := sshfile.InventoryCallback(path)
+
+	if _, err := cb(context.Background(), "tcp", "web:22"); !xerrors.Is(err, os.ErrNotExist) {
+		t.Fatalf("got %v, want not exist error", err)
+	}
+
+	for _, user := range []string{"admin", "deploy"} {
+		inv := "hosts:\n  - host: web\n    User: " + user + "\n    StrictHostKeyChecking: no\n"
+
+		if err := ioutil.WriteFile(path, []byte(inv), 0644); err != nil {
+			t.Fatalf("WriteFile()=%s", err)
+		}
+
+		cfg, err := cb(context.Background(), "tcp", "web:22")
+		if err != nil {
+			t.Fatalf("Callback()=%s", err)
+		}
+
+		if cfg.User != user {
+			t.Fatalf("got %q, want %q", cfg.User, user)
+		}
+	}
+}
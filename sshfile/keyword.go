@@ -0,0 +1,181 @@
+package sshfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var keywords = func() map[string]struct{} {
+	m := make(map[string]struct{})
+	typ := reflect.TypeOf(Config{})
+
+	for i := 0; i < typ.NumField(); i++ {
+		tag := typ.Field(i).Tag.Get("json")
+		if j := strings.IndexRune(tag, ','); j != -1 {
+			tag = tag[:j]
+		}
+		if tag != "" && tag != "-" && tag != "host" && tag != "match" && tag != "origins" {
+			m[tag] = struct{}{}
+		}
+	}
+
+	return m
+}()
+
+var keywordAliases = map[string]string{
+	"challengeresponseauthentication": "kbdinteractiveauthentication",
+	"hostbasedkeytypes":               "hostbasedacceptedalgorithms",
+	"pubkeyacceptedkeytypes":          "pubkeyacceptedalgorithms",
+	"skeyauthentication":              "kbdinteractiveauthentication",
+	"tisauthentication":               "kbdinteractiveauthentication",
+}
+
+var deprecatedKeywords = map[string]struct{}{
+	"afstokenpassing":         {},
+	"cipher":                  {},
+	"compressionlevel":        {},
+	"dsaauthentication":       {},
+	"fallbacktorsh":           {},
+	"kerberosauthentication":  {},
+	"kerberostgtpassing":      {},
+	"protocol":                {},
+	"rhostsauthentication":    {},
+	"rhostsrsaauthentication": {},
+	"rsaauthentication":       {},
+	"useblacklistedkeys":      {},
+	"useprivilegedport":       {},
+	"useroaming":              {},
+	"usersh":                  {},
+}
+
+var cumulativeKeywords = map[string]struct{}{
+	"certificatefile": {},
+	"identityfile":    {},
+}
+
+// supportedKeywords are the keywords that have an effect on the connections,
+// the remaining ones are parsed, exported and printed, but otherwise ignored.
+var supportedKeywords = map[string]struct{}{
+	"canonicaldomains":            {},
+	"canonicalizefallbacklocal":   {},
+	"canonicalizehostname":        {},
+	"canonicalizemaxdots":         {},
+	"canonicalizepermittedcnames": {},
+	"certificatefile":             {},
+	"ciphers":                     {},
+	"connecttimeout":              {},
+	"globalknownhostsfile":        {},
+	"hostkeyalgorithms":           {},
+	"hostkeyalias":                {},
+	"hostname":                    {},
+	"identitiesonly":              {},
+	"identityagent":               {},
+	"identityfile":                {},
+	"ignoreunknown":               {},
+	"kexalgorithms":               {},
+	"macs":                        {},
+	"port":                        {},
+	"proxyjump":                   {},
+	"rekeylimit":                  {},
+	"serveralivecountmax":         {},
+	"serveraliveinterval":         {},
+	"stricthostkeychecking":       {},
+	"tag":                         {},
+	"tcpkeepalive":                {},
+	"user":                        {},
+	"userknownhostsfile":          {},
+}
+
+// Supported reports whether the given keyword, in its canonical form, has
+// an effect on the connections made with the config.
+func Supported(k string) bool {
+	_, ok := supportedKeywords[k]
+	return ok
+}
+
+// Keyword returns the canonical, lowercase form of the given ssh_config
+// keyword and reports whether it is one of the keywords Config models.
+func Keyword(k string) (string, bool) {
+	k = strings.ToLower(k)
+
+	if alias, ok := keywordAliases[k]; ok {
+		k = alias
+	}
+
+	_, ok := keywords[k]
+
+	return k, ok
+}
+
+type UnknownKeywordError struct {
+	Line    int
+	Keyword string
+	Reason  string
+}
+
+func (e *UnknownKeywordError) Error() string {
+	reason := e.Reason
+	if reason == "" {
+		reason = "unknown keyword"
+	}
+	if e.Line != 0 {
+		return fmt.Sprintf("line %d: %s %q", e.Line, reason, e.Keyword)
+	}
+	return fmt.Sprintf("%s %q", reason, e.Keyword)
+}
+
+type values map[string]interface{}
+
+// set sets the keyword, unless it is already set, as the first value
+// obtained is used. The values of cumulative keywords accumulate. It
+// reports whether the value was used.
+func (v values) set(k, s string) bool {
+	s = unquote(s)
+
+	if _, ok := cumulativeKeywords[k]; ok {
+		list, _ := v[k].([]string)
+		v[k] = append(list, s)
+		return true
+	}
+	if _, ok := v[k]; ok {
+		return false
+	}
+	v[k] = s
+	return true
+}
+
+func (v values) merge(cfg *Config) error {
+	p, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	var m map[string]interface{}
+
+	if err := json.Unmarshal(p, &m); err != nil {
+		return err
+	}
+
+	delete(m, "host")
+	delete(m, "match")
+	delete(m, "origins")
+
+	for k, val := range m {
+		if _, ok := cumulativeKeywords[k]; ok {
+			list, _ := val.([]interface{})
+			for _, s := range list {
+				if s, ok := s.(string); ok {
+					v.set(k, s)
+				}
+			}
+			continue
+		}
+		if _, ok := v[k]; !ok {
+			v[k] = val
+		}
+	}
+
+	return nil
+}
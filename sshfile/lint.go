@@ -0,0 +1,369 @@
+package sshfile
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is a single problem reported by Lint.
+type Diagnostic struct {
+	File     string
+	Line     int
+	Col      int
+	Severity Severity
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	file := d.File
+	if file == "" {
+		file = "<input>"
+	}
+	return fmt.Sprintf("%s:%d:%d: %s: %s", file, d.Line, d.Col, d.Severity, d.Message)
+}
+
+var deprecatedAlgorithms = map[string]struct{}{
+	"3des-cbc":                           {},
+	"aes128-cbc":                         {},
+	"aes192-cbc":                         {},
+	"aes256-cbc":                         {},
+	"arcfour":                            {},
+	"arcfour128":                         {},
+	"arcfour256":                         {},
+	"blowfish-cbc":                       {},
+	"cast128-cbc":                        {},
+	"rijndael-cbc@lysator.liu.se":        {},
+	"hmac-md5":                           {},
+	"hmac-md5-96":                        {},
+	"hmac-md5-etm@openssh.com":           {},
+	"hmac-md5-96-etm@openssh.com":        {},
+	"hmac-ripemd160":                     {},
+	"hmac-sha1-96":                       {},
+	"hmac-sha1-96-etm@openssh.com":       {},
+	"umac-64@openssh.com":                {},
+	"diffie-hellman-group1-sha1":         {},
+	"diffie-hellman-group14-sha1":        {},
+	"diffie-hellman-group-exchange-sha1": {},
+	"ssh-dss":                            {},
+	"ssh-dss-cert-v01@openssh.com":       {},
+	"ssh-rsa":                            {},
+	"ssh-rsa-cert-v01@openssh.com":       {},
+}
+
+var algorithmKeywords = map[string]struct{}{
+	"casignaturealgorithms":       {},
+	"ciphers":                     {},
+	"hostbasedacceptedalgorithms": {},
+	"hostkeyalgorithms":           {},
+	"kexalgorithms":               {},
+	"macs":                        {},
+	"pubkeyacceptedalgorithms":    {},
+}
+
+// Lint reads ssh_config content from r and reports problems found in it,
+// like unknown or unsupported keywords, settings shadowed by earlier blocks, missing or
+// unprotected identity files and insecure settings. The file is used for
+// reporting only, included files are not checked.
+func Lint(r io.Reader, file string) ([]Diagnostic, error) {
+	f, err := ParseFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &linter{file: file}
+	l.lint(f)
+
+	sort.SliceStable(l.diags, func(i, j int) bool {
+		return l.diags[i].Line < l.diags[j].Line
+	})
+
+	return l.diags, nil
+}
+
+type linter struct {
+	file   string
+	diags  []Diagnostic
+	ignore string
+}
+
+// setting records where a keyword was set for all hosts of a block.
+type setting struct {
+	line  int
+	block string
+}
+
+type hostBlock struct {
+	line     int
+	header   string
+	patterns []string
+	negated  bool
+	set      map[string]setting
+}
+
+func (l *linter) report(line, col int, sev Severity, format string, v ...interface{}) {
+	l.diags = append(l.diags, Diagnostic{
+		File:     l.file,
+		Line:     line,
+		Col:      col,
+		Severity: sev,
+		Message:  fmt.Sprintf(format, v...),
+	})
+}
+
+func (l *linter) lint(f *File) {
+	var (
+		lineno int
+		global = make(map[string]setting)
+		hosts  []*hostBlock
+	)
+
+	for _, ln := range f.Global.Lines {
+		lineno++
+
+		if k := l.line(ln, lineno); k != "" {
+			l.set(global, k, ln, lineno, "global")
+		}
+	}
+
+	for _, b := range f.Blocks {
+		lineno++
+
+		header, start := b.Header, lineno
+
+		if !strings.EqualFold(header.Keyword, "Host") {
+			for _, ln := range b.Lines {
+				lineno++
+				l.line(ln, lineno)
+			}
+			continue
+		}
+
+		var (
+			h           = newHostBlock(header, start)
+			set         = h.inherit(global, hosts)
+			n, shadowed int
+		)
+
+		for _, ln := range b.Lines {
+			lineno++
+
+			k := l.line(ln, lineno)
+			if k == "" {
+				continue
+			}
+
+			n++
+
+			if !l.set(set, k, ln, lineno, h.header) {
+				shadowed++
+			}
+
+			if _, ok := h.set[k]; !ok {
+				h.set[k] = setting{line: lineno, block: h.header}
+			}
+		}
+
+		if prev := h.duplicate(hosts); prev != nil {
+			l.report(start, len(header.Indent)+1, SeverityWarning, "duplicate %s block, first defined at line %d", h.header, prev.line)
+		} else if n != 0 && n == shadowed {
+			l.report(start, len(header.Indent)+1, SeverityWarning, "%s block is unreachable, all of its keywords are set by earlier blocks", h.header)
+		}
+
+		hosts = append(hosts, h)
+	}
+}
+
+// set records the keyword in set and reports whether it has any effect,
+// which is not the case if it was already set for the same hosts, as the
+// first obtained value is used.
+func (l *linter) set(set map[string]setting, k string, ln *Line, lineno int, block string) bool {
+	if _, ok := cumulativeKeywords[k]; ok {
+		return true
+	}
+
+	if s, ok := set[k]; ok {
+		l.report(lineno, len(ln.Indent)+1, SeverityWarning, "%s has no effect, already set at line %d (%s)", ln.Keyword, s.line, s.block)
+		return false
+	}
+
+	set[k] = setting{line: lineno, block: block}
+
+	return true
+}
+
+// line checks a single line and returns its canonical keyword, unless the
+// line is a comment or the keyword is not a known one.
+func (l *linter) line(ln *Line, lineno int) string {
+	if ln.IsComment() || strings.EqualFold(ln.Keyword, "Include") {
+		return ""
+	}
+
+	col, vcol := len(ln.Indent)+1, len(ln.Indent)+len(ln.Keyword)+len(ln.Sep)+1
+
+	k, ok := Keyword(ln.Keyword)
+	if _, deprecated := deprecatedKeywords[k]; deprecated {
+		l.report(lineno, col, SeverityWarning, "deprecated keyword %q", ln.Keyword)
+		return ""
+	}
+
+	if !ok {
+		if !matchList(strings.ToLower(l.ignore), k) {
+			l.report(lineno, col, SeverityError, "unknown keyword %q", ln.Keyword)
+		}
+		return ""
+	}
+
+	if k == "ignoreunknown" {
+		l.ignore = ln.Value
+	}
+
+	if !Supported(k) {
+		l.report(lineno, col, SeverityWarning, "%s is not supported and has no effect", ln.Keyword)
+	}
+
+	l.value(k, ln, lineno, vcol)
+
+	return k
+}
+
+func (l *linter) value(k string, ln *Line, lineno, col int) {
+	value := unquote(ln.Value)
+
+	switch k {
+	case "stricthostkeychecking":
+		switch strings.ToLower(value) {
+		case "no", "off", "false":
+			l.report(lineno, col, SeverityWarning, "insecure setting %s %s disables host key verification", ln.Keyword, value)
+		}
+	case "userknownhostsfile", "globalknownhostsfile":
+		for _, file := range strings.Fields(value) {
+			if file == "/dev/null" {
+				l.report(lineno, col, SeverityWarning, "insecure setting %s %s discards known host keys", ln.Keyword, file)
+			}
+		}
+	case "identityfile":
+		l.identity(value, lineno, col)
+	}
+
+	if _, ok := algorithmKeywords[k]; ok && !strings.HasPrefix(value, "-") {
+		for _, alg := range strings.Split(strings.TrimLeft(value, "+^"), ",") {
+			if _, ok := deprecatedAlgorithms[strings.ToLower(alg)]; ok {
+				l.report(lineno, col, SeverityWarning, "deprecated algorithm %q in %s", alg, ln.Keyword)
+			}
+		}
+	}
+}
+
+func (l *linter) identity(file string, lineno, col int) {
+	if strings.ContainsAny(file, "%$") || strings.EqualFold(file, "none") {
+		return
+	}
+
+	file, err := expandTilde(file, nil)
+	if err != nil {
+		return
+	}
+
+	if !filepath.IsAbs(file) {
+		u, err := user.Current()
+		if err != nil {
+			return
+		}
+		file = filepath.Join(u.HomeDir, file)
+	}
+
+	fi, err := os.Stat(file)
+	if os.IsNotExist(err) {
+		l.report(lineno, col, SeverityWarning, "identity file %q does not exist", file)
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	if perm := fi.Mode().Perm(); perm&0077 != 0 {
+		l.report(lineno, col, SeverityError, "permissions %04o for identity file %q are too open", perm, file)
+	}
+}
+
+func newHostBlock(header *Line, line int) *hostBlock {
+	h := &hostBlock{
+		line:   line,
+		header: "Host " + strings.Join(strings.Fields(header.Value), " "),
+		set:    make(map[string]setting),
+	}
+
+	for _, p := range strings.Fields(strings.ToLower(unquote(header.Value))) {
+		if strings.HasPrefix(p, "!") {
+			h.negated = true
+			continue
+		}
+		h.patterns = append(h.patterns, p)
+	}
+
+	return h
+}
+
+// covers reports whether the block applies to every host the other block
+// applies to.
+func (h *hostBlock) covers(other *hostBlock) bool {
+	if h.negated || len(other.patterns) == 0 {
+		return false
+	}
+
+loop:
+	for _, q := range other.patterns {
+		for _, p := range h.patterns {
+			if matchPattern(p, q) {
+				continue loop
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// inherit returns the keywords that are already set for all hosts of the
+// block by the global section and earlier Host blocks.
+func (h *hostBlock) inherit(global map[string]setting, hosts []*hostBlock) map[string]setting {
+	set := make(map[string]setting, len(global))
+
+	for k, v := range global {
+		set[k] = v
+	}
+
+	for _, prev := range hosts {
+		if !prev.covers(h) {
+			continue
+		}
+		for k, v := range prev.set {
+			if _, ok := set[k]; !ok {
+				set[k] = v
+			}
+		}
+	}
+
+	return set
+}
+
+func (h *hostBlock) duplicate(hosts []*hostBlock) *hostBlock {
+	for _, prev := range hosts {
+		if prev.header == h.header {
+			return prev
+		}
+	}
+	return nil
+}
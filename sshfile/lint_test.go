@@ -0,0 +1,88 @@
+package sshfile_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/glaucusio/ssh/sshfile"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshfile")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	key := filepath.Join(dir, "id_test")
+
+	if err := ioutil.WriteFile(key, []byte("key"), 0644); err != nil {
+		t.Fatalf("WriteFile()=%s", err)
+	}
+
+	config := `User admin
+Bogus yes
+
+Host web
+	User root
+	Port 22
+	Port 2222
+	IdentityFile ` + key + `
+	IdentityFile ` + key + `.missing
+
+Host *
+	StrictHostKeyChecking no
+	UserKnownHostsFile /dev/null
+	Ciphers aes128-ctr,3des-cbc
+
+Host web1 web
+	StrictHostKeyChecking yes
+
+Host web
+	Protocol 2
+
+Host *.example.com
+	Ciphers aes256-ctr
+	User root
+
+Host db
+	ForwardAgent yes
+`
+
+	got, err := sshfile.Lint(strings.NewReader(config), "config")
+	if err != nil {
+		t.Fatalf("Lint()=%s", err)
+	}
+
+	want := []string{
+		`config:2:1: error: unknown keyword "Bogus"`,
+		`config:5:2: warning: User has no effect, already set at line 1 (global)`,
+		`config:7:2: warning: Port has no effect, already set at line 6 (Host web)`,
+		`config:8:15: error: permissions 0644 for identity file "` + key + `" are too open`,
+		`config:9:15: warning: identity file "` + key + `.missing" does not exist`,
+		`config:12:24: warning: insecure setting StrictHostKeyChecking no disables host key verification`,
+		`config:13:21: warning: insecure setting UserKnownHostsFile /dev/null discards known host keys`,
+		`config:14:10: warning: deprecated algorithm "3des-cbc" in Ciphers`,
+		`config:16:1: warning: Host web1 web block is unreachable, all of its keywords are set by earlier blocks`,
+		`config:17:2: warning: StrictHostKeyChecking has no effect, already set at line 12 (Host *)`,
+		`config:19:1: warning: duplicate Host web block, first defined at line 4`,
+		`config:20:2: warning: deprecated keyword "Protocol"`,
+		`config:22:1: warning: Host *.example.com block is unreachable, all of its keywords are set by earlier blocks`,
+		`config:23:2: warning: Ciphers has no effect, already set at line 14 (Host *)`,
+		`config:24:2: warning: User has no effect, already set at line 1 (global)`,
+		`config:27:2: warning: ForwardAgent is not supported and has no effect`,
+	}
+
+	var lines []string
+	for _, d := range got {
+		lines = append(lines, d.String())
+	}
+
+	if !cmp.Equal(lines, want) {
+		t.Fatalf("got != want:\n%s", cmp.Diff(lines, want))
+	}
+}
@@ -0,0 +1,252 @@
+package sshfile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os/exec"
+	"os/user"
+	"strings"
+)
+
+var matchCriteria = map[string]bool{
+	"all":          false,
+	"canonical":    false,
+	"final":        false,
+	"exec":         true,
+	"host":         true,
+	"originalhost": true,
+	"user":         true,
+	"localuser":    true,
+	"localnetwork": true,
+	"tagged":       true,
+}
+
+type Criterion struct {
+	Negate  bool
+	Keyword string
+	Arg     string
+}
+
+func (c Criterion) String() string {
+	s := c.Keyword
+	if c.Negate {
+		s = "!" + s
+	}
+	if c.Arg != "" {
+		if strings.ContainsAny(c.Arg, " \t") {
+			return s + ` "` + c.Arg + `"`
+		}
+		return s + " " + c.Arg
+	}
+	return s
+}
+
+// Match is a list of criteria of a Match block, all of which must be
+// satisfied for the block to apply.
+type Match []Criterion
+
+var (
+	_ json.Marshaler   = Match(nil)
+	_ json.Unmarshaler = (*Match)(nil)
+)
+
+func ParseMatch(s string) (Match, error) {
+	var (
+		m      Match
+		fields = splitQuoted(s)
+	)
+
+	for i := 0; i < len(fields); i++ {
+		c := Criterion{Keyword: strings.ToLower(fields[i])}
+
+		if strings.HasPrefix(c.Keyword, "!") {
+			c.Negate, c.Keyword = true, c.Keyword[1:]
+		}
+
+		arg, ok := matchCriteria[c.Keyword]
+		if !ok {
+			return nil, fmt.Errorf("unsupported match criterion %q", fields[i])
+		}
+
+		if arg {
+			if i++; i == len(fields) {
+				return nil, fmt.Errorf("missing argument for %q match criterion", c.Keyword)
+			}
+
+			c.Arg = fields[i]
+		}
+
+		m = append(m, c)
+	}
+
+	if len(m) == 0 {
+		return nil, fmt.Errorf("missing match criteria")
+	}
+
+	return m, nil
+}
+
+func (m Match) String() string {
+	s := make([]string, 0, len(m))
+	for _, c := range m {
+		s = append(s, c.String())
+	}
+	return strings.Join(s, " ")
+}
+
+func (m Match) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+func (m *Match) UnmarshalJSON(p []byte) error {
+	var s string
+	if err := json.Unmarshal(p, &s); err != nil {
+		return err
+	}
+	if s == "" {
+		*m = nil
+		return nil
+	}
+	v, err := ParseMatch(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+type matchContext struct {
+	ctx          context.Context
+	host         string
+	originalHost string
+	user         string
+	localUser    string
+	tag          string
+	canonical    bool
+	final        bool
+}
+
+func newMatchContext(ctx context.Context, host string, global *Config) *matchContext {
+	mc := &matchContext{
+		ctx:          ctx,
+		host:         host,
+		originalHost: host,
+	}
+
+	if u, err := user.Current(); err == nil {
+		mc.localUser = u.Username
+	}
+
+	mc.user = mc.localUser
+
+	if global != nil {
+		if global.User != "" {
+			mc.user = global.User
+		}
+
+		mc.tag = global.Tag
+	}
+
+	return mc
+}
+
+// match reports whether the config applies to the host of the context.
+func (mc *matchContext) match(cfg *Config) bool {
+	return cfg.match(mc)
+}
+
+func (m Match) match(mc *matchContext) bool {
+	for _, c := range m {
+		if c.match(mc) == c.Negate {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Criterion) match(mc *matchContext) bool {
+	switch c.Keyword {
+	case "all":
+		return true
+	case "canonical":
+		return mc.canonical
+	case "final":
+		return mc.final
+	case "host":
+		return matchList(strings.ToLower(c.Arg), strings.ToLower(mc.host))
+	case "originalhost":
+		return matchList(strings.ToLower(c.Arg), strings.ToLower(mc.originalHost))
+	case "user":
+		return matchList(c.Arg, mc.user)
+	case "localuser":
+		return matchList(c.Arg, mc.localUser)
+	case "tagged":
+		return matchList(c.Arg, mc.tag)
+	case "localnetwork":
+		return matchLocalNetwork(c.Arg)
+	case "exec":
+		cmd, err := expand(c.Arg, (&Config{User: mc.user}).tokens(mc.host), tokensCommand, false)
+		if err != nil {
+			return false
+		}
+		return exec.CommandContext(mc.ctx, "/bin/sh", "-c", cmd).Run() == nil
+	}
+	return false
+}
+
+func matchLocalNetwork(list string) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+
+	for _, cidr := range strings.FieldsFunc(list, isListSep) {
+		negate := strings.HasPrefix(cidr, "!")
+
+		_, network, err := net.ParseCIDR(strings.TrimPrefix(cidr, "!"))
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range addrs {
+			if ip, ok := addr.(*net.IPNet); ok && network.Contains(ip.IP) {
+				return !negate
+			}
+		}
+	}
+
+	return false
+}
+
+func splitQuoted(s string) []string {
+	var (
+		fields []string
+		buf    strings.Builder
+		quoted bool
+		word   bool
+	)
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted, word = !quoted, true
+		case (r == ' ' || r == '\t') && !quoted:
+			if word {
+				fields = append(fields, buf.String())
+				buf.Reset()
+				word = false
+			}
+		default:
+			buf.WriteRune(r)
+			word = true
+		}
+	}
+
+	if word {
+		fields = append(fields, buf.String())
+	}
+
+	return fields
+}
@@ -1,35 +1,253 @@
 package sshfile
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
+	"github.com/glaucusio/ssh"
+
 	"github.com/spf13/pflag"
 )
 
-func ParseArgs(args []string) (*Config, error) {
-	var options []string
+func ParseArgs(args []string) (*Invocation, error) {
+	return DefaultParser.ParseArgs(args)
+}
+
+func ParseOptions(options []string) (*Config, error) {
+	return DefaultParser.ParseOptions(options)
+}
+
+// Invocation is an ssh command line.
+type Invocation struct {
+	// Config holds the settings given with -o and with the flags that
+	// are equivalent to a keyword, like -p for Port or -J for ProxyJump.
+	// It also holds the user and port given in the destination, unless
+	// they were set with flags or options.
+	Config *Config
+
+	ConfigFile  string   // -F
+	LogFile     string   // -E
+	Destination string   // destination as given on the command line
+	Host        string   // host of the destination
+	Fingerprint string   // host key fingerprint given in the destination
+	Command     []string // remote command
+
+	// Forwardings can be given multiple times, so unlike the equivalent
+	// keywords they are not part of the Config.
+	LocalForward   []string // -L
+	RemoteForward  []string // -R
+	DynamicForward []string // -D
+	StdioForward   string   // -W
+}
+
+type flagOption struct {
+	keyword string
+	value   string // fixed value, if the flag takes no argument
+}
+
+var flagOptions = map[string]flagOption{
+	"4": {"AddressFamily", "inet"},
+	"6": {"AddressFamily", "inet6"},
+	"A": {"ForwardAgent", "yes"},
+	"a": {"ForwardAgent", "no"},
+	"b": {"BindAddress", ""},
+	"C": {"Compression", "yes"},
+	"c": {"Ciphers", ""},
+	"f": {"ForkAfterAuthentication", "yes"},
+	"i": {"IdentityFile", ""},
+	"J": {"ProxyJump", ""},
+	"l": {"User", ""},
+	"m": {"MACs", ""},
+	"N": {"SessionType", "none"},
+	"p": {"Port", ""},
+	"q": {"LogLevel", "QUIET"},
+	"T": {"RequestTTY", "no"},
+}
+
+var logLevels = []string{"DEBUG1", "DEBUG2", "DEBUG3"}
+
+func (p *Parser) ParseArgs(args []string) (*Invocation, error) {
+	var (
+		inv     = new(Invocation)
+		options []string
+		sources []string
+		flags   []string
+		fsource []string
+		verbose int
+		tty     int
+	)
+
+	// Like ssh, a flag overrides the earlier ones and the -o options,
+	// regardless of their order, except the cumulative -i, which keeps
+	// its place among the -o IdentityFile options.
+	setFlag := func(keyword, value, source string) {
+		if keyword == "IdentityFile" {
+			options, sources = append(options, keyword+"="+value), append(sources, source)
+			return
+		}
+		for i := range flags {
+			if strings.HasPrefix(flags[i], keyword+"=") {
+				flags, fsource = append(flags[:i], flags[i+1:]...), append(fsource[:i], fsource[i+1:]...)
+				break
+			}
+		}
+		flags, fsource = append(flags, keyword+"="+value), append(fsource, source)
+	}
 
 	f := pflag.NewFlagSet("ssh", pflag.ContinueOnError)
-	f.StringArrayVarP(&options, "option", "o", nil, "")
+	f.SetInterspersed(false)
+
+	for _, name := range []string{"4", "6", "A", "a", "C", "f", "N", "q", "T"} {
+		f.BoolP(name, name, false, "")
+	}
+
+	for _, name := range []string{"b", "c", "E", "F", "i", "J", "l", "m", "o", "p", "D", "L", "R", "W"} {
+		f.StringP(name, name, "", "")
+	}
+
+	f.CountP("v", "v", "")
+	f.CountP("t", "t", "")
+
+	fn := func(flag *pflag.Flag, value string) error {
+		switch name := flag.Shorthand; name {
+		case "o":
+			options, sources = append(options, value), append(sources, "command line option -o")
+		case "v":
+			if verbose < len(logLevels) {
+				verbose++
+			}
+			setFlag("LogLevel", logLevels[verbose-1], "command line flag -v")
+		case "t":
+			if tty++; tty == 1 {
+				setFlag("RequestTTY", "yes", "command line flag -t")
+			} else {
+				setFlag("RequestTTY", "force", "command line flag -t")
+			}
+		case "F":
+			inv.ConfigFile = value
+		case "E":
+			inv.LogFile = value
+		case "L":
+			inv.LocalForward = append(inv.LocalForward, value)
+		case "R":
+			inv.RemoteForward = append(inv.RemoteForward, value)
+		case "D":
+			inv.DynamicForward = append(inv.DynamicForward, value)
+		case "W":
+			inv.StdioForward = value
+		default:
+			opt := flagOptions[name]
+			if opt.value != "" {
+				value = opt.value
+			}
+			setFlag(opt.keyword, value, "command line flag -"+name)
+		}
+		return nil
+	}
 
-	if err := f.Parse(args); err != nil {
+	if err := f.ParseAll(args, fn); err != nil {
 		return nil, fmt.Errorf("unable to parse flags: %w", err)
 	}
 
-	return ParseOptions(options)
+	if rest := f.Args(); len(rest) != 0 {
+		inv.Destination, rest = rest[0], rest[1:]
+
+		// Like ssh, allow flags to follow the destination.
+		if len(rest) != 0 && strings.HasPrefix(rest[0], "-") {
+			if err := f.ParseAll(rest, fn); err != nil {
+				return nil, fmt.Errorf("unable to parse flags: %w", err)
+			}
+			rest = f.Args()
+		}
+
+		if len(rest) != 0 {
+			inv.Command = rest
+		}
+	}
+
+	cfg, err := p.parseOptions(options, sources)
+	if err != nil {
+		return nil, err
+	}
+
+	mixin, err := p.parseOptions(flags, fsource)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Merge(mixin); err != nil {
+		return nil, err
+	}
+
+	if inv.Destination != "" {
+		d, err := ssh.ParseDestination(inv.Destination)
+		if err != nil {
+			return nil, err
+		}
+
+		if d.Path != "" {
+			return nil, fmt.Errorf("unexpected path in destination %q", inv.Destination)
+		}
+
+		inv.Host, inv.Fingerprint = d.Host, d.Fingerprint
+
+		cfg.ApplyDestination(d)
+	}
+
+	inv.Config = cfg
+
+	return inv, nil
 }
 
-func ParseOptions(options []string) (*Config, error) {
-	tmp := make(map[string]string)
+// ParseOptions parses keyword=value options, as given with -o. Like ssh,
+// the first value of a keyword wins, except for the cumulative keywords,
+// like IdentityFile, which collect all the values.
+func (p *Parser) ParseOptions(options []string) (*Config, error) {
+	cfg, err := p.parseOptions(options, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, p.finish(cfg)
+}
+
+func (p *Parser) parseOptions(options, sources []string) (*Config, error) {
+	var (
+		tmp     = make(values)
+		origins = make(Origins)
+		ignore  string
+	)
 
-	for _, kv := range options {
+	for i, kv := range options {
 		k, v, err := parsekv(kv)
 		if err != nil {
 			return nil, fmt.Errorf("unexpected %q flag: %w", kv, err)
 		}
 
-		tmp[strings.ToLower(k)] = v
+		k, ok, err := p.keyword(k, 0, ignore)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if _, ok := tmp[k]; ok {
+			if _, ok := cumulativeKeywords[k]; !ok {
+				continue
+			}
+		}
+		if k == "ignoreunknown" {
+			ignore = v
+		}
+
+		tmp.set(k, v)
+
+		if i < len(sources) {
+			origins[k] = Origin{Source: sources[i]}
+		} else {
+			origins[k] = Origin{Source: "command line option -o"}
+		}
 	}
 
 	hc := new(Config)
@@ -38,5 +256,64 @@ func ParseOptions(options []string) (*Config, error) {
 		return nil, fmt.Errorf("unexpected flags: %w", err)
 	}
 
+	hc.Origins.merge(origins)
+
 	return hc, nil
 }
+
+// SplitArgs splits the command line into arguments the way a POSIX shell
+// does, honouring single and double quotes and backslash escapes.
+func SplitArgs(s string) ([]string, error) {
+	var (
+		words []string
+		buf   strings.Builder
+		word  bool
+	)
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			if word {
+				words = append(words, buf.String())
+				buf.Reset()
+				word = false
+			}
+		case c == '\\':
+			if i++; i == len(s) {
+				return nil, errors.New("trailing backslash")
+			}
+			buf.WriteByte(s[i])
+			word = true
+		case c == '\'':
+			j := strings.IndexByte(s[i+1:], '\'')
+			if j == -1 {
+				return nil, errors.New("unterminated single quote")
+			}
+			buf.WriteString(s[i+1 : i+1+j])
+			i, word = i+1+j, true
+		case c == '"':
+			for i++; ; i++ {
+				if i == len(s) {
+					return nil, errors.New("unterminated double quote")
+				}
+				if s[i] == '"' {
+					break
+				}
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`", s[i+1]) != -1 {
+					i++
+				}
+				buf.WriteByte(s[i])
+			}
+			word = true
+		default:
+			buf.WriteByte(c)
+			word = true
+		}
+	}
+
+	if word {
+		words = append(words, buf.String())
+	}
+
+	return words, nil
+}
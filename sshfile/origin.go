@@ -0,0 +1,128 @@
+package sshfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Origin describes where the value of a keyword was set.
+type Origin struct {
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Block  string `json:"block,omitempty"`
+	Source string `json:"source,omitempty"`
+}
+
+func (o Origin) String() string {
+	if o.Source != "" {
+		return o.Source
+	}
+
+	file := o.File
+	if file == "" {
+		file = "<input>"
+	}
+
+	block := o.Block
+	if block == "" {
+		block = "global"
+	}
+
+	if o.Line != 0 {
+		return fmt.Sprintf("%s:%d (%s)", file, o.Line, block)
+	}
+
+	return fmt.Sprintf("%s (%s)", file, block)
+}
+
+// Origins maps lowercase keywords to the origin of their values.
+type Origins map[string]Origin
+
+func (o *Origins) merge(in Origins) {
+	if len(in) == 0 {
+		return
+	}
+	if *o == nil {
+		*o = make(Origins, len(in))
+	}
+	for k, v := range in {
+		(*o)[k] = v
+	}
+}
+
+func (o Origins) commandLine(k string) bool {
+	return strings.HasPrefix(o[k].Source, "command line")
+}
+
+// Setting is a single keyword value of a config.
+type Setting struct {
+	Keyword string
+	Value   string
+	Origin  Origin
+}
+
+func (s Setting) String() string {
+	return s.Keyword + " " + s.Value
+}
+
+var keywordOrder = func() []string {
+	var order []string
+	typ := reflect.TypeOf(Config{})
+
+	for i := 0; i < typ.NumField(); i++ {
+		tag := typ.Field(i).Tag.Get("json")
+		if j := strings.IndexRune(tag, ','); j != -1 {
+			tag = tag[:j]
+		}
+		if _, ok := keywords[tag]; ok {
+			order = append(order, tag)
+		}
+	}
+
+	return order
+}()
+
+// Settings returns the keywords set in the config, in the order of Config
+// fields, together with their origins. Values of cumulative keywords,
+// like IdentityFile, are returned as separate settings.
+func (c *Config) Settings() []Setting {
+	p, err := json.Marshal(c)
+	if err != nil {
+		panic("unexpected error: " + err.Error())
+	}
+
+	var m map[string]interface{}
+
+	if err := json.Unmarshal(p, &m); err != nil {
+		panic("unexpected error: " + err.Error())
+	}
+
+	var settings []Setting
+
+	for _, k := range keywordOrder {
+		switch v := m[k].(type) {
+		case string:
+			settings = append(settings, Setting{Keyword: k, Value: v, Origin: c.Origins[k]})
+		case []interface{}:
+			if _, ok := cumulativeKeywords[k]; !ok {
+				settings = append(settings, Setting{Keyword: k, Value: joinList(v), Origin: c.Origins[k]})
+				continue
+			}
+			for _, v := range v {
+				settings = append(settings, Setting{Keyword: k, Value: fmt.Sprint(v), Origin: c.Origins[k]})
+			}
+		}
+	}
+
+	return settings
+}
+
+func joinList(list []interface{}) string {
+	s := make([]string, 0, len(list))
+	for _, v := range list {
+		s = append(s, fmt.Sprint(v))
+	}
+	return strings.Join(s, " ")
+}
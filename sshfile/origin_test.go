@@ -0,0 +1,81 @@
+package sshfile_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/glaucusio/ssh"
+	"github.com/glaucusio/ssh/sshfile"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConfigSettingsOrigins(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshfile")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	config, extra := filepath.Join(dir, "config"), filepath.Join(dir, "extra.conf")
+
+	files := map[string]string{
+		config: "Include extra.conf\nUser admin\n\nHost web\n\tHostname web.example.com\n\tPort 22\n",
+		extra:  "IdentityFile ~/.ssh/id_extra\nConnectTimeout 10\n",
+	}
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile()=%s", err)
+		}
+	}
+
+	cfgs, err := sshfile.ParseConfigFile(config)
+	if err != nil {
+		t.Fatalf("ParseConfigFile()=%s", err)
+	}
+
+	cfg, err := cfgs.Lookup(context.Background(), "web")
+	if err != nil {
+		t.Fatalf("Lookup()=%s", err)
+	}
+
+	mixin, err := sshfile.ParseOptions([]string{"Port=2200"})
+	if err != nil {
+		t.Fatalf("ParseOptions()=%s", err)
+	}
+
+	if err := cfg.Merge(mixin); err != nil {
+		t.Fatalf("Merge()=%s", err)
+	}
+
+	d, err := ssh.ParseDestination("deploy@web:2300")
+	if err != nil {
+		t.Fatalf("ParseDestination()=%s", err)
+	}
+
+	cfg.ApplyDestination(d)
+
+	got := make(map[string]sshfile.Origin)
+	for _, s := range cfg.Settings() {
+		got[s.Keyword] = s.Origin
+	}
+
+	want := map[string]sshfile.Origin{
+		"hostname":       {File: config, Line: 5, Block: "Host web"},
+		"connecttimeout": {File: extra, Line: 2},
+		"identityfile":   {File: extra, Line: 1},
+		"port":           {Source: "command line option -o"},
+		"user":           {Source: "destination " + d.String()},
+	}
+
+	if !cmp.Equal(got, want) {
+		t.Fatalf("got != want:\n%s", cmp.Diff(got, want))
+	}
+
+	if s := want["hostname"].String(); s != config+":5 (Host web)" {
+		t.Fatalf("unexpected origin string: %q", s)
+	}
+}
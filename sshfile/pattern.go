@@ -0,0 +1,57 @@
+package sshfile
+
+import (
+	"strings"
+)
+
+func matchPattern(pattern, s string) bool {
+	for len(pattern) != 0 {
+		switch pattern[0] {
+		case '*':
+			for pattern != "" && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchPattern(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+		default:
+			if s == "" || pattern[0] != s[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return s == ""
+}
+
+func matchList(list, s string) bool {
+	var matched bool
+
+	for _, pattern := range strings.FieldsFunc(list, isListSep) {
+		if strings.HasPrefix(pattern, "!") {
+			if matchPattern(pattern[1:], s) {
+				return false
+			}
+			continue
+		}
+		if matchPattern(pattern, s) {
+			matched = true
+		}
+	}
+
+	return matched
+}
+
+func isListSep(r rune) bool {
+	return r == ',' || r == ' ' || r == '\t'
+}
@@ -1,10 +1,17 @@
 package sshfile
 
-func nonempty(s ...string) (t []string) {
-	for _, s := range s {
-		if s != "" {
-			t = append(t, s)
+func nonil(err ...error) error {
+	for _, e := range err {
+		if e != nil {
+			return e
 		}
 	}
-	return t
+	return nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
 }
@@ -28,11 +28,172 @@ func (d *Duration) UnmarshalJSON(p []byte) error {
 	if err := json.Unmarshal(p, &s); err != nil {
 		return err
 	}
-	n, err := strconv.Atoi(s)
+	t, err := ParseDuration(s)
 	if err != nil {
 		return err
 	}
-	*d = Duration(time.Duration(n) * time.Second)
+	*d = Duration(t)
+	return nil
+}
+
+var timeUnits = map[byte]time.Duration{
+	's': time.Second,
+	'm': time.Minute,
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+}
+
+// ParseDuration parses the time format described in the TIME FORMATS
+// section of sshd_config(5), e.g. "90", "1m30s" or "1W2d". The "none"
+// and "infinity" values are parsed as zero duration, which means
+// no timeout.
+func ParseDuration(s string) (time.Duration, error) {
+	switch strings.ToLower(s) {
+	case "none", "infinity":
+		return 0, nil
+	case "":
+		return 0, fmt.Errorf("unexpected empty duration")
+	}
+
+	var d time.Duration
+
+	for t := strings.ToLower(s); t != ""; {
+		i := 0
+		for i < len(t) && t[i] >= '0' && t[i] <= '9' {
+			i++
+		}
+
+		if i == 0 {
+			return 0, fmt.Errorf("unexpected duration value: %q", s)
+		}
+
+		n, err := strconv.ParseInt(t[:i], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("unexpected duration value: %q", s)
+		}
+
+		unit := time.Second
+
+		if i < len(t) {
+			u, ok := timeUnits[t[i]]
+			if !ok {
+				return 0, fmt.Errorf("unexpected duration unit in %q", s)
+			}
+
+			unit, i = u, i+1
+		}
+
+		d += time.Duration(n) * unit
+		t = t[i:]
+	}
+
+	return d, nil
+}
+
+type Size int64
+
+var (
+	_ json.Marshaler   = new(Size)
+	_ json.Unmarshaler = new(Size)
+)
+
+var sizeUnits = []byte{'k', 'm', 'g', 't'}
+
+func (s Size) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s *Size) UnmarshalJSON(p []byte) error {
+	var v string
+	if err := json.Unmarshal(p, &v); err != nil {
+		return err
+	}
+	n, err := ParseSize(v)
+	if err != nil {
+		return err
+	}
+	*s = Size(n)
+	return nil
+}
+
+func (s Size) String() string {
+	n, unit := int64(s), ""
+
+	for i := 0; n != 0 && n%1024 == 0 && i < len(sizeUnits); i++ {
+		n, unit = n/1024, strings.ToUpper(string(sizeUnits[i]))
+	}
+
+	return strconv.FormatInt(n, 10) + unit
+}
+
+// ParseSize parses byte sizes with optional K, M, G or T suffixes,
+// as used by the RekeyLimit keyword.
+func ParseSize(s string) (int64, error) {
+	t := strings.ToLower(s)
+	mult := int64(1)
+
+	for i, unit := range sizeUnits {
+		if strings.HasSuffix(t, string(unit)) {
+			t, mult = t[:len(t)-1], 1<<(10*uint(i+1))
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("unexpected size value: %q", s)
+	}
+
+	return n * mult, nil
+}
+
+type RekeyLimit struct {
+	Data Size
+	Time Duration
+}
+
+var (
+	_ json.Marshaler   = RekeyLimit{}
+	_ json.Unmarshaler = new(RekeyLimit)
+)
+
+func (r RekeyLimit) MarshalJSON() ([]byte, error) {
+	data, t := "default", "none"
+	if r.Data != 0 {
+		data = r.Data.String()
+	}
+	if r.Time != 0 {
+		t = strconv.Itoa(int(r.Time.Duration() / time.Second))
+	}
+	return json.Marshal(data + " " + t)
+}
+
+func (r *RekeyLimit) UnmarshalJSON(p []byte) error {
+	var s string
+	if err := json.Unmarshal(p, &s); err != nil {
+		return err
+	}
+	f := strings.Fields(s)
+	if len(f) == 0 || len(f) > 2 {
+		return fmt.Errorf("unexpected rekey limit value: %q", s)
+	}
+	var lim RekeyLimit
+	if strings.ToLower(f[0]) != "default" {
+		n, err := ParseSize(f[0])
+		if err != nil {
+			return err
+		}
+		lim.Data = Size(n)
+	}
+	if len(f) == 2 {
+		d, err := ParseDuration(f[1])
+		if err != nil {
+			return err
+		}
+		lim.Time = Duration(d)
+	}
+	*r = lim
 	return nil
 }
 
@@ -65,12 +226,122 @@ func (b *Bool) UnmarshalJSON(p []byte) error {
 		return err
 	}
 	switch strings.ToLower(s) {
-	case "yes":
+	case "yes", "true":
 		*b = true
-	case "no":
+	case "no", "false":
 		*b = false
 	default:
 		return fmt.Errorf("unexpected boolean value: %q", s)
 	}
 	return nil
 }
+
+type Strings []string
+
+var (
+	_ json.Marshaler   = Strings(nil)
+	_ json.Unmarshaler = (*Strings)(nil)
+)
+
+func (s Strings) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]string(s))
+}
+
+func (s *Strings) UnmarshalJSON(p []byte) error {
+	var list []string
+	if err := json.Unmarshal(p, &list); err == nil {
+		*s = list
+		return nil
+	}
+	var v string
+	if err := json.Unmarshal(p, &v); err != nil {
+		return err
+	}
+	*s = strings.Fields(v)
+	return nil
+}
+
+func (s Strings) clone() Strings {
+	if len(s) == 0 {
+		return nil
+	}
+	return append(Strings(nil), s...)
+}
+
+func (s Strings) ptrs() []*string {
+	p := make([]*string, len(s))
+	for i := range s {
+		p[i] = &s[i]
+	}
+	return p
+}
+
+type HostKeyChecking string
+
+const (
+	HostKeyCheckingYes       HostKeyChecking = "yes"
+	HostKeyCheckingNo        HostKeyChecking = "no"
+	HostKeyCheckingAsk       HostKeyChecking = "ask"
+	HostKeyCheckingAcceptNew HostKeyChecking = "accept-new"
+)
+
+var _ json.Unmarshaler = new(HostKeyChecking)
+
+func (h *HostKeyChecking) UnmarshalJSON(p []byte) error {
+	s, err := unmarshalChoice(p, "yes", "no", "ask", "accept-new", "off", "true", "false")
+	if err != nil {
+		return err
+	}
+	switch s {
+	case "off", "false":
+		s = "no"
+	case "true":
+		s = "yes"
+	}
+	*h = HostKeyChecking(s)
+	return nil
+}
+
+// Ask is a yes/no/ask tri-state, as used by the UpdateHostKeys and
+// VerifyHostKeyDNS keywords.
+type Ask string
+
+const (
+	AskYes Ask = "yes"
+	AskNo  Ask = "no"
+	AskAsk Ask = "ask"
+)
+
+var _ json.Unmarshaler = new(Ask)
+
+func (a *Ask) UnmarshalJSON(p []byte) error {
+	s, err := unmarshalChoice(p, "yes", "no", "ask", "true", "false")
+	if err != nil {
+		return err
+	}
+	switch s {
+	case "true":
+		s = "yes"
+	case "false":
+		s = "no"
+	}
+	*a = Ask(s)
+	return nil
+}
+
+func unmarshalChoice(p []byte, choices ...string) (string, error) {
+	var s string
+	if err := json.Unmarshal(p, &s); err != nil {
+		return "", err
+	}
+	if s == "" {
+		return "", nil
+	}
+	t := strings.ToLower(s)
+	for _, choice := range choices {
+		if t == choice {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("unexpected value %q, expected one of: %s", s, strings.Join(choices, ", "))
+}
@@ -0,0 +1,94 @@
+package sshfile_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/glaucusio/ssh/sshfile"
+)
+
+func TestParseDuration(t *testing.T) {
+	cases := map[string]time.Duration{
+		"0":        0,
+		"600":      10 * time.Minute,
+		"10m":      10 * time.Minute,
+		"1m30s":    90 * time.Second,
+		"1h30m":    90 * time.Minute,
+		"2d":       48 * time.Hour,
+		"1W2d":     9 * 24 * time.Hour,
+		"none":     0,
+		"infinity": 0,
+	}
+
+	for s, want := range cases {
+		got, err := sshfile.ParseDuration(s)
+		if err != nil {
+			t.Errorf("ParseDuration(%q)=%s", s, err)
+			continue
+		}
+
+		if got != want {
+			t.Errorf("ParseDuration(%q)=%s, want %s", s, got, want)
+		}
+	}
+
+	for _, s := range []string{"", "m", "10x", "1.5h", "-1"} {
+		if _, err := sshfile.ParseDuration(s); err == nil {
+			t.Errorf("ParseDuration(%q): expected error", s)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{
+		"512":  512,
+		"1K":   1 << 10,
+		"500M": 500 << 20,
+		"4g":   4 << 30,
+	}
+
+	for s, want := range cases {
+		got, err := sshfile.ParseSize(s)
+		if err != nil {
+			t.Errorf("ParseSize(%q)=%s", s, err)
+			continue
+		}
+
+		if got != want {
+			t.Errorf("ParseSize(%q)=%d, want %d", s, got, want)
+		}
+	}
+
+	for _, s := range []string{"", "G", "1X", "-1K"} {
+		if _, err := sshfile.ParseSize(s); err == nil {
+			t.Errorf("ParseSize(%q): expected error", s)
+		}
+	}
+}
+
+func TestChoices(t *testing.T) {
+	var cfg sshfile.Config
+
+	p := `{"stricthostkeychecking": "off", "verifyhostkeydns": "ASK", "rekeylimit": "default 1h"}`
+
+	if err := json.Unmarshal([]byte(p), &cfg); err != nil {
+		t.Fatalf("json.Unmarshal()=%s", err)
+	}
+
+	if cfg.StrictHostKeyChecking != sshfile.HostKeyCheckingNo {
+		t.Errorf("StrictHostKeyChecking=%q", cfg.StrictHostKeyChecking)
+	}
+
+	if cfg.VerifyHostKeyDNS != sshfile.AskAsk {
+		t.Errorf("VerifyHostKeyDNS=%q", cfg.VerifyHostKeyDNS)
+	}
+
+	if cfg.RekeyLimit == nil || cfg.RekeyLimit.Data != 0 || cfg.RekeyLimit.Time.Duration() != time.Hour {
+		t.Errorf("RekeyLimit=%+v", cfg.RekeyLimit)
+	}
+
+	if err := json.Unmarshal([]byte(`{"stricthostkeychecking": "maybe"}`), &cfg); err == nil {
+		t.Errorf("json.Unmarshal(): expected error")
+	}
+}
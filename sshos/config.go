@@ -3,27 +3,13 @@ package sshos
 import (
 	"fmt"
 	"os"
-	"os/user"
 	"path/filepath"
 )
 
 func UserConfig(username string) (*os.File, error) {
-	usr, err := (*user.User)(nil), error(nil)
-
-	if username == "" {
-		usr, err = user.Current()
-	} else {
-		usr, err = user.Lookup(username)
-	}
-
+	dir, err := userDir(username)
 	if err != nil {
-		return nil, fmt.Errorf("failed to lookup user: %w", err)
-	}
-
-	dir := filepath.Join(usr.HomeDir, ".ssh")
-
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return nil, fmt.Errorf("failed to create %q directory: %w", dir, err)
+		return nil, err
 	}
 
 	file := filepath.Join(dir, "config")
@@ -35,3 +21,18 @@ func UserConfig(username string) (*os.File, error) {
 
 	return f, nil
 }
+
+func userDir(username string) (string, error) {
+	usr, err := lookupUser(username)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(usr.HomeDir, ".ssh")
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create %q directory: %w", dir, err)
+	}
+
+	return dir, nil
+}
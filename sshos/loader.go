@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/user"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/glaucusio/ssh"
 	"github.com/glaucusio/ssh/sshfile"
@@ -13,67 +16,99 @@ import (
 	"golang.org/x/crypto/ssh/knownhosts"
 )
 
+// DefaultOverlay is the path of the project config, relative to the project
+// directory.
+const DefaultOverlay = ".gossh/config"
+
+var DefaultLoader = NewLoader("")
+
 func NewClient() (*ssh.Client, error) {
 	return DefaultLoader.NewClient()
 }
 
+// Loader builds clients from ssh_config and known_hosts files. Empty fields
+// default to the standard files in Dir, which defaults to ~/.ssh, and to the
+// system wide ones.
 type Loader struct {
 	Dir              string
 	UserConfig       string
 	UserKnownHosts   string
 	SystemConfig     string
 	SystemKnownHosts string
-	Identity         []string
+	Identity         []string // used by the hosts with no IdentityFile configured
 	Options          []string
+	Parser           *sshfile.Parser
+	WatchInterval    time.Duration // how often Watch polls the files
+
+	// Overlay is the path of the project config, which is looked up in
+	// WorkDir, the current directory by default, and its parents, unless
+	// it is absolute. It defaults to DefaultOverlay, "none" disables it.
+	// The project config takes precedence over the system config, but not
+	// over the user one.
+	Overlay string
+	WorkDir string
+
+	// User is the owner of the files, the current user if nil. Dir defaults
+	// to the .ssh directory in its home.
+	User *user.User
+
+	// StrictModes enables checks like the ones OpenSSH does: the user,
+	// project and known hosts files and their directories must belong to
+	// the user or root and must not be writable by others, otherwise
+	// an error wrapping ErrBadPermissions is returned. Identity files
+	// readable by others are ignored.
+	StrictModes bool
 }
 
-func (l *Loader) NewClient() (*ssh.Client, error) {
-	var mixin *sshfile.Config
+// NewLoader returns a loader with all the paths set to their defaults
+// for the given ssh directory, or for ~/.ssh if it is empty. The paths
+// are resolved by NewLoader, so setting User afterwards does not change
+// them; a Loader with only User set resolves them in its home instead.
+func NewLoader(dir string) *Loader {
+	l := &Loader{Dir: dir}
 
-	if len(l.options()) != 0 {
-		var err error
-		if mixin, err = sshfile.ParseOptions(l.options()); err != nil {
-			return nil, fmt.Errorf("failed to parse options: %w", err)
-		}
+	return &Loader{
+		Dir:              l.dir(),
+		UserConfig:       l.userConfig(),
+		UserKnownHosts:   l.userKnownHosts(),
+		SystemConfig:     l.systemConfig(),
+		SystemKnownHosts: l.systemKnownHosts(),
+		Identity:         l.identity(),
 	}
+}
 
-	usr, err := sshfile.ParseConfigFile(l.userConfig())
-	if err != nil && !is(err, os.ErrNotExist, os.ErrPermission) {
-		return nil, fmt.Errorf("failed to parse %q user config: %w", l.userConfig(), err)
+func (l *Loader) NewClient() (*ssh.Client, error) {
+	cb, err := l.callback()
+	if err != nil {
+		return nil, err
 	}
 
-	sys, err := sshfile.ParseConfigFile(l.systemConfig())
-	if err != nil && !is(err, os.ErrNotExist, os.ErrPermission) {
-		return nil, fmt.Errorf("failed to parse %q system config: %w", l.systemConfig(), err)
+	c := &ssh.Client{
+		ConfigCallback: cb,
 	}
 
-	cfgfile := usr.Merge(sys)
+	return c, nil
+}
 
-	if mixin != nil {
-		for i := range cfgfile {
-			if err := cfgfile[i].Merge(mixin); err != nil {
-				return nil, fmt.Errorf("%d: unable to apply custom options: %w", i, err)
-			}
-		}
+func (l *Loader) callback() (ssh.ConfigCallback, error) {
+	cfgfile, err := l.Config()
+	if err != nil {
+		return nil, err
 	}
 
-	cb := cfgfile.Callback()
+	return l.configCallback(cfgfile)
+}
 
-	auth, err := sshfile.IdentityAuth(l.identity()...)
-	if err != nil && !is(err, sshfile.NoAuthMethods) {
-		return nil, fmt.Errorf("failed to build identity auth: %w", err)
-	}
+func (l *Loader) configCallback(cfgfile sshfile.Configs) (ssh.ConfigCallback, error) {
+	cb := sshutil.NamedCallback("ssh_config", cfgfile.Callback())
 
-	if auth != nil {
-		cb = sshutil.PatchCallback(cb, func(_ context.Context, cfg *ssh.Config) error {
-			cfg.Auth = append(cfg.Auth, auth)
-			return nil
-		})
+	if err := l.checkFile(l.userKnownHosts(), 022); err != nil {
+		return nil, &ssh.ConfigError{Source: "known hosts files", Err: err}
 	}
 
 	known, err := knownhosts.New(l.userKnownHosts(), l.systemKnownHosts())
 	if err != nil && !is(err, os.ErrNotExist, os.ErrPermission) {
-		return nil, fmt.Errorf("failed to parse %q, %q known hosts files: %w", l.userKnownHosts(), l.systemKnownHosts(), err)
+		return nil, &ssh.ConfigError{Source: "known hosts files", Err: err}
 	}
 
 	if known != nil {
@@ -95,20 +130,77 @@ func (l *Loader) NewClient() (*ssh.Client, error) {
 		return nil
 	})
 
-	c := &ssh.Client{
-		ConfigCallback: cb,
+	return cb, nil
+}
+
+// Config returns the user and system configs merged together, with custom
+// options applied on top of them.
+func (l *Loader) Config() (sshfile.Configs, error) {
+	var mixin *sshfile.Config
+
+	if len(l.options()) != 0 {
+		var err error
+		if mixin, err = l.parser().ParseOptions(l.options()); err != nil {
+			return nil, &ssh.ConfigError{Source: "custom options", Err: err}
+		}
 	}
 
-	return c, nil
+	usr, err := l.parser().ParseConfigFile(l.userConfig())
+	if err != nil && !is(err, os.ErrNotExist, os.ErrPermission) {
+		return nil, &ssh.ConfigError{Source: "user config", Err: err}
+	}
+
+	sys, err := l.parser().ParseConfigFile(l.systemConfig())
+	if err != nil && !is(err, os.ErrNotExist, os.ErrPermission) {
+		return nil, &ssh.ConfigError{Source: "system config", Err: err}
+	}
+
+	if overlay := l.overlay(); overlay != "" {
+		prj, err := l.parser().ParseConfigFile(overlay)
+		if err != nil && !is(err, os.ErrNotExist, os.ErrPermission) {
+			return nil, &ssh.ConfigError{Source: "project config", Err: err}
+		}
+
+		usr = usr.Merge(prj)
+	}
+
+	cfgfile := usr.Merge(sys)
+
+	if mixin != nil {
+		for i := range cfgfile {
+			if err := cfgfile[i].Merge(mixin); err != nil {
+				return nil, fmt.Errorf("%d: unable to apply custom options: %w", i, err)
+			}
+		}
+	}
+
+	// The defaults apply to the hosts without the settings configured,
+	// like the built-in ones of ssh: the identity files are tried only
+	// if the host has none, and the remote user is the user of the loader.
+	defaults := &sshfile.Config{Origins: make(sshfile.Origins)}
+
+	if identity := l.identities(); len(identity) != 0 {
+		defaults.IdentityFile = identity
+		defaults.Origins["identityfile"] = sshfile.Origin{Source: "identity files"}
+	}
+
+	if l.User != nil {
+		defaults.User = l.User.Username
+		defaults.Origins["user"] = sshfile.Origin{Source: "local user"}
+	}
+
+	if len(defaults.Origins) != 0 {
+		cfgfile = cfgfile.Default(defaults)
+	}
+
+	return cfgfile, nil
 }
 
 func (l *Loader) copy() *Loader {
 	lCopy := *l
 
-	if len(l.Options) != 0 {
-		lCopy.Options = make([]string, len(l.Options))
-		copy(lCopy.Options, l.Options)
-	}
+	lCopy.Identity = append([]string(nil), l.Identity...)
+	lCopy.Options = append([]string(nil), l.Options...)
 
 	return &lCopy
 }
@@ -117,47 +209,146 @@ func (l *Loader) dir() string {
 	if l.Dir != "" {
 		return l.Dir
 	}
-	return DefaultLoader.Dir
+	if l.User != nil {
+		return filepath.Join(l.User.HomeDir, ".ssh")
+	}
+	return filepath.Join(homeDir(), ".ssh")
+}
+
+func (l *Loader) user() (*user.User, error) {
+	if l.User != nil {
+		return l.User, nil
+	}
+	return user.Current()
+}
+
+func (l *Loader) warn(err error) {
+	if p := l.parser(); p.Warn != nil {
+		p.Warn(err)
+	}
 }
 
 func (l *Loader) userConfig() string {
 	if l.UserConfig != "" {
 		return l.UserConfig
 	}
-	return DefaultLoader.UserConfig
+	return filepath.Join(l.dir(), "config")
 }
 
 func (l *Loader) userKnownHosts() string {
 	if l.UserKnownHosts != "" {
 		return l.UserKnownHosts
 	}
-	return DefaultLoader.UserKnownHosts
+	return filepath.Join(l.dir(), "known_hosts")
 }
 
 func (l *Loader) systemConfig() string {
 	if l.SystemConfig != "" {
 		return l.SystemConfig
 	}
-	return DefaultLoader.SystemConfig
+	return filepath.Join(systemDir, "ssh_config")
 }
 
 func (l *Loader) systemKnownHosts() string {
 	if l.SystemKnownHosts != "" {
 		return l.SystemKnownHosts
 	}
-	return DefaultLoader.SystemKnownHosts
+	return filepath.Join(systemDir, "known_hosts")
 }
 
 func (l *Loader) identity() []string {
 	if len(l.Identity) != 0 {
 		return l.Identity
 	}
-	return DefaultLoader.Identity
+
+	identity := make([]string, 0, len(identityFiles))
+	for _, name := range identityFiles {
+		identity = append(identity, filepath.Join(l.dir(), name))
+	}
+
+	return identity
+}
+
+// identities returns the identity files, without the ones failing
+// the StrictModes checks.
+func (l *Loader) identities() []string {
+	var identity []string
+
+	for _, file := range l.identity() {
+		if err := l.checkFile(file, 077); err != nil {
+			l.warn(fmt.Errorf("ignoring identity file: %w", err))
+			continue
+		}
+
+		identity = append(identity, file)
+	}
+
+	return identity
 }
 
 func (l *Loader) options() []string {
-	if len(l.Options) != 0 {
-		return l.Options
+	return l.Options
+}
+
+// parser returns the parser for the files of the user of the loader,
+// checking them if StrictModes is enabled.
+func (l *Loader) parser() *sshfile.Parser {
+	p := *sshfile.DefaultParser
+	if l.Parser != nil {
+		p = *l.Parser
+	}
+
+	if l.User != nil {
+		p.User = l.User
+	}
+
+	if l.StrictModes {
+		p.CheckFile = func(path string, private bool) error {
+			if private {
+				return l.checkFile(path, 077)
+			}
+			return l.checkFile(path, 022)
+		}
+	}
+
+	return &p
+}
+
+// overlay returns path of the project config, or an empty string if there
+// is none.
+func (l *Loader) overlay() string {
+	name := l.Overlay
+
+	switch {
+	case name == "none":
+		return ""
+	case name == "":
+		name = DefaultOverlay
+	case filepath.IsAbs(name):
+		return name
+	}
+
+	dir := l.WorkDir
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return ""
+		}
+		dir = wd
+	}
+
+	for {
+		path := filepath.Join(dir, name)
+
+		if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+			return path
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+
+		dir = parent
 	}
-	return DefaultLoader.Options
 }
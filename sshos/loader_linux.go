@@ -3,31 +3,27 @@
 package sshos
 
 import (
+	"os"
 	"os/user"
-	"path/filepath"
 )
 
-var DefaultLoader = &Loader{
-	Dir:              filepath.Join(home, ".ssh", "config"),
-	UserConfig:       filepath.Join(home, ".ssh", "config"),
-	UserKnownHosts:   filepath.Join(home, ".ssh", "known_hosts"),
-	SystemConfig:     filepath.FromSlash("/etc/ssh/ssh_config"),
-	SystemKnownHosts: filepath.FromSlash("/etc/ssh/known_hosts"),
-	Identity: []string{
-		filepath.Join(home, ".ssh", "id_dsa"),
-		filepath.Join(home, ".ssh", "id_ecdsa"),
-		filepath.Join(home, ".ssh", "id_ed25519"),
-		filepath.Join(home, ".ssh", "id_rsa"),
-	},
-}
+const systemDir = "/etc/ssh"
 
-var home = currentUserHomeDir()
+var identityFiles = []string{
+	"id_dsa",
+	"id_ecdsa",
+	"id_ed25519",
+	"id_rsa",
+}
 
-func currentUserHomeDir() string {
-	u, err := user.Current()
-	if err != nil {
-		panic("unexpected error reading home dir: " + err.Error())
+// homeDir returns home directory of the current user, or an empty string
+// if it can not be determined.
+func homeDir() string {
+	if u, err := user.Current(); err == nil {
+		return u.HomeDir
 	}
 
-	return u.HomeDir
+	dir, _ := os.UserHomeDir()
+
+	return dir
 }
@@ -0,0 +1,256 @@
+package sshos_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	"github.com/glaucusio/ssh/sshfile"
+	"github.com/glaucusio/ssh/sshos"
+	"github.com/glaucusio/xerrors"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoaderOverlay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshos")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string) {
+		t.Helper()
+
+		path := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("MkdirAll()=%s", err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile()=%s", err)
+		}
+	}
+
+	write(".ssh/config", "Host web\n\tUser admin\n")
+	write("etc/ssh_config", "Host web\n\tUser root\n\nHost db\n\tUser postgres\n")
+	write("project/.gossh/config", "Host web\n\tUser deploy\n\nHost db\n\tUser app\n")
+
+	if err := os.MkdirAll(filepath.Join(dir, "project", "src", "cmd"), 0755); err != nil {
+		t.Fatalf("MkdirAll()=%s", err)
+	}
+
+	l := sshos.NewLoader(filepath.Join(dir, ".ssh"))
+	l.SystemConfig = filepath.Join(dir, "etc", "ssh_config")
+	l.Parser = &sshfile.Parser{}
+	l.WorkDir = filepath.Join(dir, "project", "src", "cmd")
+
+	if want := filepath.Join(dir, ".ssh", "config"); l.UserConfig != want {
+		t.Fatalf("got %q, want %q", l.UserConfig, want)
+	}
+
+	user := func(host string) string {
+		t.Helper()
+
+		cfgfile, err := l.Config()
+		if err != nil {
+			t.Fatalf("Config()=%s", err)
+		}
+
+		cfg, err := cfgfile.Lookup(context.Background(), host)
+		if err != nil {
+			t.Fatalf("Lookup()=%s", err)
+		}
+
+		return cfg.User
+	}
+
+	for host, want := range map[string]string{"web": "admin", "db": "app"} {
+		if got := user(host); got != want {
+			t.Errorf("%s: got %q, want %q", host, got, want)
+		}
+	}
+
+	l.Overlay = "none"
+
+	if got := user("db"); got != "postgres" {
+		t.Fatalf("got %q, want %q", got, "postgres")
+	}
+}
+
+func TestLoaderIdentitiesOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshos")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := fmt.Sprintf("Host web\n\tIdentitiesOnly yes\n\tIdentityFile %s\n", filepath.Join(dir, "id_web"))
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "config"), []byte(config), 0600); err != nil {
+		t.Fatalf("WriteFile()=%s", err)
+	}
+
+	l := sshos.NewLoader(dir)
+	l.SystemConfig = filepath.Join(dir, "ssh_config")
+	l.Identity = []string{filepath.Join(dir, "id_ed25519"), filepath.Join(dir, "id_rsa")}
+	l.Parser = &sshfile.Parser{}
+	l.Overlay = "none"
+
+	cfgfile, err := l.Config()
+	if err != nil {
+		t.Fatalf("Config()=%s", err)
+	}
+
+	for host, want := range map[string][]string{
+		"web": {filepath.Join(dir, "id_web")},
+		"db":  l.Identity,
+	} {
+		cfg, err := cfgfile.Lookup(context.Background(), host)
+		if err != nil {
+			t.Fatalf("Lookup()=%s", err)
+		}
+
+		if !cmp.Equal([]string(cfg.IdentityFile), want) {
+			t.Errorf("%s: got != want:\n%s", host, cmp.Diff([]string(cfg.IdentityFile), want))
+		}
+	}
+}
+
+func TestLoaderStrictModes(t *testing.T) {
+	home, err := ioutil.TempDir("", "sshos")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(home)
+
+	cur, err := user.Current()
+	if err != nil {
+		t.Skipf("Current()=%s", err)
+	}
+
+	dir := filepath.Join(home, ".ssh")
+
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatalf("Mkdir()=%s", err)
+	}
+
+	config := filepath.Join(dir, "config")
+
+	if err := ioutil.WriteFile(config, []byte("Host web\n\tUser admin\n"), 0600); err != nil {
+		t.Fatalf("WriteFile()=%s", err)
+	}
+
+	if err := os.Chmod(config, 0664); err != nil {
+		t.Fatalf("Chmod()=%s", err)
+	}
+
+	l := sshos.NewLoader(dir)
+	l.Parser = &sshfile.Parser{}
+	l.Overlay = "none"
+	l.User = &user.User{Uid: cur.Uid, Username: cur.Username, HomeDir: home}
+	l.StrictModes = true
+
+	if _, err := l.Config(); !xerrors.Is(err, sshos.ErrBadPermissions) {
+		t.Fatalf("got %v, want %v", err, sshos.ErrBadPermissions)
+	}
+
+	if err := os.Chmod(config, 0600); err != nil {
+		t.Fatalf("Chmod()=%s", err)
+	}
+
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatalf("Chmod()=%s", err)
+	}
+
+	if _, err := l.Config(); !xerrors.Is(err, sshos.ErrBadPermissions) {
+		t.Fatalf("got %v, want %v", err, sshos.ErrBadPermissions)
+	}
+
+	if err := os.Chmod(dir, 0700); err != nil {
+		t.Fatalf("Chmod()=%s", err)
+	}
+
+	if _, err := l.Config(); err != nil {
+		t.Fatalf("Config()=%s", err)
+	}
+
+	include := filepath.Join(dir, "web.conf")
+
+	if err := ioutil.WriteFile(config, []byte("Include ~/.ssh/web.conf\n"), 0600); err != nil {
+		t.Fatalf("WriteFile()=%s", err)
+	}
+
+	if err := ioutil.WriteFile(include, []byte("Host web\n\tIdentityFile ~/.ssh/id_web\n\tIdentityFile ~/.ssh/id_%u\n"), 0600); err != nil {
+		t.Fatalf("WriteFile()=%s", err)
+	}
+
+	if err := os.Chmod(include, 0666); err != nil {
+		t.Fatalf("Chmod()=%s", err)
+	}
+
+	if _, err := l.Config(); !xerrors.Is(err, sshos.ErrBadPermissions) {
+		t.Fatalf("got %v, want %v", err, sshos.ErrBadPermissions)
+	}
+
+	if err := os.Chmod(include, 0600); err != nil {
+		t.Fatalf("Chmod()=%s", err)
+	}
+
+	for name, perm := range map[string]os.FileMode{"id_web": 0644, "id_" + cur.Username: 0600} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, perm); err != nil {
+			t.Fatalf("WriteFile()=%s", err)
+		}
+	}
+
+	cfgfile, err := l.Config()
+	if err != nil {
+		t.Fatalf("Config()=%s", err)
+	}
+
+	cfg, err := cfgfile.Lookup(context.Background(), "web")
+	if err != nil {
+		t.Fatalf("Lookup()=%s", err)
+	}
+
+	if cfg.User != cur.Username {
+		t.Errorf("got %q user, want %q", cfg.User, cur.Username)
+	}
+
+	if want := filepath.Join(dir, "id_"+cur.Username); len(cfg.IdentityFile) == 0 || cfg.IdentityFile[0] != want {
+		t.Errorf("got %q identity files, want %q first", cfg.IdentityFile, want)
+	}
+
+	for _, file := range cfg.IdentityFile {
+		if filepath.Base(file) == "id_web" {
+			t.Errorf("got %q identity file readable by others", file)
+		}
+	}
+
+	users := &sshos.Users{
+		Setup: func(l *sshos.Loader) {
+			*l = *sshos.NewLoader(dir)
+			l.Parser = &sshfile.Parser{}
+			l.Overlay = "none"
+		},
+	}
+
+	c, err := users.NewClient(cur.Username)
+	if err != nil {
+		t.Fatalf("NewClient()=%s", err)
+	}
+
+	if cached, err := users.NewClient(cur.Uid); err != nil || cached != c {
+		t.Fatalf("got %p, %v, want cached %p", cached, err, c)
+	}
+
+	users.Invalidate(cur.Uid)
+
+	if fresh, err := users.NewClient(cur.Username); err != nil || fresh == c {
+		t.Fatalf("got %p, %v, want a new client", fresh, err)
+	}
+}
@@ -0,0 +1,40 @@
+// +build linux
+
+package sshos
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+func lockFile(path string) (unlock func() error, err error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %q lock file: %w", path, err)
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock %q: %w", path, err)
+	}
+
+	unlock = func() error {
+		return nonil(syscall.Flock(int(f.Fd()), syscall.LOCK_UN), f.Close())
+	}
+
+	return unlock, nil
+}
+
+func chown(f *os.File, fi os.FileInfo) error {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	if err := f.Chown(int(st.Uid), int(st.Gid)); err != nil && !os.IsPermission(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,330 @@
+package sshos
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/glaucusio/ssh/sshfile"
+)
+
+// Managed owns a part of an ssh_config file - either a section delimited
+// with begin and end marker comments, or a dedicated file included from
+// the config - and updates it atomically, leaving the rest of the config
+// untouched.
+type Managed struct {
+	File    string // config file, defaults to the user config of the DefaultLoader
+	Name    string // name used in the marker comments, defaults to "gossh"
+	Include string // optional dedicated file, included from File and relative to its directory
+	Backup  bool   // whether to keep a copy of the previous content with .bak suffix
+}
+
+func UserManaged(username string) (*Managed, error) {
+	dir, err := userDir(username)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Managed{File: filepath.Join(dir, "config")}, nil
+}
+
+// Read returns the current content of the managed part of the config.
+func (m *Managed) Read() (*sshfile.File, error) {
+	if m.Include != "" {
+		return readFile(m.include())
+	}
+
+	p, err := ioutil.ReadFile(m.file())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	_, section, _, err := m.split(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return sshfile.ParseFile(bytes.NewReader(section))
+}
+
+// Update applies fn to the managed part of the config and writes it back.
+// Concurrent updates are serialized with an advisory lock.
+func (m *Managed) Update(fn func(*sshfile.File) error) error {
+	dir := filepath.Dir(m.file())
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create %q directory: %w", dir, err)
+	}
+
+	unlock, err := lockFile(m.file() + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if m.Include != "" {
+		return m.updateInclude(fn)
+	}
+
+	p, err := ioutil.ReadFile(m.file())
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %q: %w", m.file(), err)
+	}
+
+	head, section, tail, err := m.split(p)
+	if err != nil {
+		return err
+	}
+
+	f, err := sshfile.ParseFile(bytes.NewReader(section))
+	if err != nil {
+		return fmt.Errorf("failed to parse managed section of %q: %w", m.file(), err)
+	}
+
+	if err := fn(f); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+
+	buf.Write(head)
+	if len(head) != 0 && !bytes.HasSuffix(head, []byte("\n\n")) && section == nil {
+		if !bytes.HasSuffix(head, []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(m.begin() + "\n")
+	if b := f.Bytes(); len(b) != 0 {
+		buf.Write(b)
+		if !bytes.HasSuffix(b, []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+	}
+	buf.WriteString(m.end() + "\n")
+	buf.Write(tail)
+
+	return writeFile(m.file(), buf.Bytes(), m.Backup)
+}
+
+func (m *Managed) updateInclude(fn func(*sshfile.File) error) error {
+	include := m.include()
+
+	f, err := readFile(include)
+	if err != nil {
+		return fmt.Errorf("failed to read %q: %w", include, err)
+	}
+
+	if err := fn(f); err != nil {
+		return err
+	}
+
+	if err := writeFile(include, f.Bytes(), m.Backup); err != nil {
+		return err
+	}
+
+	cfg, err := readFile(m.file())
+	if err != nil {
+		return fmt.Errorf("failed to read %q: %w", m.file(), err)
+	}
+
+	for _, l := range cfg.Global.Lines {
+		if !strings.EqualFold(l.Keyword, "Include") {
+			continue
+		}
+
+		for _, v := range strings.Fields(l.Value) {
+			if v == m.Include || m.resolve(v) == include {
+				return nil
+			}
+		}
+	}
+
+	line := &sshfile.Line{Keyword: "Include", Sep: " ", Value: m.Include}
+	cfg.Global.Lines = append([]*sshfile.Line{line}, cfg.Global.Lines...)
+
+	return writeFile(m.file(), cfg.Bytes(), m.Backup)
+}
+
+// split splits config content into the parts before, inside and after
+// the managed section. If there is no managed section, the returned
+// section is nil and all content is returned as head. The markers are
+// matched as whole lines only, ignoring surrounding whitespace. A begin
+// marker without the end one is an error, as the section can not be told
+// apart from the rest of the config.
+func (m *Managed) split(p []byte) (head, section, tail []byte, err error) {
+	begin, start := -1, 0
+
+	for off := 0; off < len(p); {
+		next := len(p)
+		if n := bytes.IndexByte(p[off:], '\n'); n != -1 {
+			next = off + n + 1
+		}
+
+		switch line := string(bytes.TrimSpace(p[off:next])); {
+		case begin == -1 && line == m.begin():
+			begin, start = off, next
+		case begin != -1 && line == m.end():
+			return p[:begin], p[start:off], p[next:], nil
+		}
+
+		off = next
+	}
+
+	if begin == -1 {
+		return p, nil, nil, nil
+	}
+
+	return nil, nil, nil, fmt.Errorf("%q: missing %q marker of the managed section", m.file(), m.end())
+}
+
+func (m *Managed) file() string {
+	if m.File != "" {
+		return m.File
+	}
+	return DefaultLoader.UserConfig
+}
+
+// include returns path of the dedicated file, resolving relative paths
+// against the directory of the config file, like ssh does.
+func (m *Managed) include() string {
+	return m.resolve(m.Include)
+}
+
+func (m *Managed) resolve(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(m.file()), path)
+}
+
+func (m *Managed) name() string {
+	if m.Name != "" {
+		return m.Name
+	}
+	return "gossh"
+}
+
+func (m *Managed) begin() string {
+	return "# BEGIN " + m.name() + " managed block - do not edit"
+}
+
+func (m *Managed) end() string {
+	return "# END " + m.name() + " managed block"
+}
+
+func readFile(path string) (*sshfile.File, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return sshfile.ParseFile(bytes.NewReader(nil))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return sshfile.ParseFile(f)
+}
+
+// WriteFile replaces the file with the content atomically, the way
+// Managed does, so the file is never seen partially written.
+func WriteFile(path string, p []byte) error {
+	return writeFile(path, p, false)
+}
+
+// writeFile replaces the file atomically: the content is written to
+// a temporary file in the same directory, synced and renamed over
+// the original, preserving its permissions and ownership. If the path
+// is a symlink, the file it points to is replaced instead of the link.
+func writeFile(path string, p []byte, backup bool) error {
+	path, err := realPath(path)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create %q directory: %w", dir, err)
+	}
+
+	mode := os.FileMode(0600)
+
+	fi, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if fi != nil {
+		mode = fi.Mode().Perm()
+	}
+
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(p)
+
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+
+	if err == nil && fi != nil {
+		err = chown(f, fi)
+	}
+
+	if err := nonil(err, f.Sync(), f.Close()); err != nil {
+		return fmt.Errorf("failed to write %q: %w", f.Name(), err)
+	}
+
+	if backup && fi != nil {
+		orig, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %q: %w", path, err)
+		}
+
+		if err := ioutil.WriteFile(path+".bak", orig, mode); err != nil {
+			return fmt.Errorf("failed to write backup of %q: %w", path, err)
+		}
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %q: %w", path, err)
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	return nonil(d.Sync(), d.Close())
+}
+
+// realPath returns the path with the symlinks resolved. A path that does not
+// exist yet is returned as is, unless it is a dangling symlink, in which
+// case the path it points to is returned.
+func realPath(path string) (string, error) {
+	real, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return real, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to resolve %q: %w", path, err)
+	}
+
+	link, err := os.Readlink(path)
+	if err != nil {
+		return path, nil
+	}
+
+	if !filepath.IsAbs(link) {
+		link = filepath.Join(filepath.Dir(path), link)
+	}
+
+	return link, nil
+}
@@ -0,0 +1,294 @@
+package sshos_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/glaucusio/ssh/sshfile"
+	"github.com/glaucusio/ssh/sshos"
+	"github.com/google/go-cmp/cmp"
+)
+
+const (
+	begin = "# BEGIN gossh managed block - do not edit\n"
+	end   = "# END gossh managed block\n"
+)
+
+func tempConfig(t *testing.T, content string, perm os.FileMode) (dir, file string) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "sshos")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+
+	file = filepath.Join(dir, "config")
+
+	if content != "" {
+		if err := ioutil.WriteFile(file, []byte(content), perm); err != nil {
+			t.Fatalf("WriteFile()=%s", err)
+		}
+
+		if err := os.Chmod(file, perm); err != nil {
+			t.Fatalf("Chmod()=%s", err)
+		}
+	}
+
+	return dir, file
+}
+
+func readString(t *testing.T, file string) string {
+	t.Helper()
+
+	p, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("ReadFile()=%s", err)
+	}
+
+	return string(p)
+}
+
+func addHost(host, hostname string) func(*sshfile.File) error {
+	return func(f *sshfile.File) error {
+		f.AddHost(host).Set("HostName", hostname)
+		return nil
+	}
+}
+
+func TestManagedUpdate(t *testing.T) {
+	const head = "Host personal\n\tUser me\n"
+
+	dir, file := tempConfig(t, head, 0640)
+	defer os.RemoveAll(dir)
+
+	m := &sshos.Managed{File: file, Backup: true}
+
+	if err := m.Update(addHost("web", "10.0.0.1")); err != nil {
+		t.Fatalf("Update()=%s", err)
+	}
+
+	want := head + "\n" + begin + "Host web\n\tHostName 10.0.0.1\n" + end
+
+	if got := readString(t, file); got != want {
+		t.Fatalf("got != want:\n%s", cmp.Diff(got, want))
+	}
+
+	if got := readString(t, file+".bak"); got != head {
+		t.Fatalf("unexpected backup: %q", got)
+	}
+
+	// Content after the managed section is kept too.
+	tail := "\nHost *\n\tServerAliveInterval 60\n"
+
+	if err := ioutil.WriteFile(file, []byte(want+tail), 0640); err != nil {
+		t.Fatalf("WriteFile()=%s", err)
+	}
+
+	if err := m.Update(addHost("db", "10.0.0.2")); err != nil {
+		t.Fatalf("Update()=%s", err)
+	}
+
+	want = head + "\n" + begin + "Host web\n\tHostName 10.0.0.1\n\nHost db\n\tHostName 10.0.0.2\n" + end + tail
+
+	if got := readString(t, file); got != want {
+		t.Fatalf("got != want:\n%s", cmp.Diff(got, want))
+	}
+
+	f, err := m.Read()
+	if err != nil {
+		t.Fatalf("Read()=%s", err)
+	}
+
+	if f.Host("db") == nil || f.Host("personal") != nil {
+		t.Fatalf("unexpected managed section:\n%s", f.Bytes())
+	}
+
+	fi, err := os.Stat(file)
+	if err != nil {
+		t.Fatalf("Stat()=%s", err)
+	}
+
+	if perm := fi.Mode().Perm(); perm != 0640 {
+		t.Fatalf("got %04o permissions, want 0640", perm)
+	}
+
+	names, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatalf("Glob()=%s", err)
+	}
+
+	for _, name := range names {
+		if strings.Contains(filepath.Base(name), ".tmp-") {
+			t.Fatalf("temporary file left behind: %s", name)
+		}
+	}
+}
+
+func TestManagedMissingEnd(t *testing.T) {
+	const content = "Host personal\n\tUser me\n\n" + begin + "Host web\n\tHostName 10.0.0.1\n"
+
+	dir, file := tempConfig(t, content, 0600)
+	defer os.RemoveAll(dir)
+
+	m := &sshos.Managed{File: file}
+
+	if err := m.Update(addHost("db", "10.0.0.2")); err == nil {
+		t.Fatal("expected Update() to fail")
+	}
+
+	if _, err := m.Read(); err == nil {
+		t.Fatal("expected Read() to fail")
+	}
+
+	if got := readString(t, file); got != content {
+		t.Fatalf("config was modified:\n%s", got)
+	}
+}
+
+func TestManagedMarkers(t *testing.T) {
+	// The markers quoted in a comment are not the markers.
+	const head = "Host personal\n\tUser me # see " + begin + "\n"
+
+	dir, file := tempConfig(t, head+"  "+begin+"Host web\n\tHostName 10.0.0.1\n\t"+end, 0600)
+	defer os.RemoveAll(dir)
+
+	m := &sshos.Managed{File: file}
+
+	if err := m.Update(addHost("db", "10.0.0.2")); err != nil {
+		t.Fatalf("Update()=%s", err)
+	}
+
+	want := head + begin + "Host web\n\tHostName 10.0.0.1\n\nHost db\n\tHostName 10.0.0.2\n" + end
+
+	if got := readString(t, file); got != want {
+		t.Fatalf("got != want:\n%s", cmp.Diff(got, want))
+	}
+}
+
+func TestManagedSymlink(t *testing.T) {
+	dir, target := tempConfig(t, "Host personal\n\tUser me\n", 0600)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "ssh", "config")
+
+	m := &sshos.Managed{File: file}
+
+	// The directory of the config is created before it is locked.
+	if err := m.Update(addHost("web", "10.0.0.1")); err != nil {
+		t.Fatalf("Update()=%s", err)
+	}
+
+	if err := os.Remove(file); err != nil {
+		t.Fatalf("Remove()=%s", err)
+	}
+
+	if err := os.Symlink("../config", file); err != nil {
+		t.Fatalf("Symlink()=%s", err)
+	}
+
+	if err := m.Update(addHost("web", "10.0.0.1")); err != nil {
+		t.Fatalf("Update()=%s", err)
+	}
+
+	if fi, err := os.Lstat(file); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("config is no longer a symlink: %v", err)
+	}
+
+	want := "Host personal\n\tUser me\n\n" + begin + "Host web\n\tHostName 10.0.0.1\n" + end
+
+	if got := readString(t, target); got != want {
+		t.Fatalf("got != want:\n%s", cmp.Diff(got, want))
+	}
+}
+
+func TestManagedInclude(t *testing.T) {
+	const head = "Host personal\n\tUser me\n"
+
+	dir, file := tempConfig(t, head, 0600)
+	defer os.RemoveAll(dir)
+
+	m := &sshos.Managed{File: file, Include: "gossh.conf"}
+
+	for i := 0; i < 2; i++ {
+		if err := m.Update(addHost(fmt.Sprintf("web%d", i), "10.0.0.1")); err != nil {
+			t.Fatalf("Update()=%s", err)
+		}
+	}
+
+	if got, want := readString(t, file), "Include gossh.conf\n"+head; got != want {
+		t.Fatalf("got != want:\n%s", cmp.Diff(got, want))
+	}
+
+	want := "Host web0\n\tHostName 10.0.0.1\n\nHost web1\n\tHostName 10.0.0.1\n"
+
+	if got := readString(t, filepath.Join(dir, "gossh.conf")); got != want {
+		t.Fatalf("got != want:\n%s", cmp.Diff(got, want))
+	}
+
+	cfgs, err := (&sshfile.Parser{}).ParseConfigFile(file)
+	if err != nil {
+		t.Fatalf("ParseConfigFile()=%s", err)
+	}
+
+	cfg, err := cfgs.Lookup(context.Background(), "web1")
+	if err != nil {
+		t.Fatalf("Lookup()=%s", err)
+	}
+
+	if cfg.Hostname != "10.0.0.1" {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+}
+
+func TestManagedConcurrentUpdate(t *testing.T) {
+	dir, file := tempConfig(t, "", 0600)
+	defer os.RemoveAll(dir)
+
+	const n = 16
+
+	var wg sync.WaitGroup
+
+	errs := make(chan error, n)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			m := &sshos.Managed{File: file}
+			errs <- m.Update(addHost(fmt.Sprintf("host%02d", i), "10.0.0.1"))
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Update()=%s", err)
+		}
+	}
+
+	f, err := (&sshos.Managed{File: file}).Read()
+	if err != nil {
+		t.Fatalf("Read()=%s", err)
+	}
+
+	var hosts []string
+	for _, b := range f.Blocks {
+		hosts = append(hosts, b.Header.Value)
+	}
+	sort.Strings(hosts)
+
+	if len(hosts) != n || hosts[0] != "host00" || hosts[n-1] != fmt.Sprintf("host%02d", n-1) {
+		t.Fatalf("lost updates: %q", hosts)
+	}
+}
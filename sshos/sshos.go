@@ -12,3 +12,12 @@ func is(err error, errs ...error) bool {
 	}
 	return false
 }
+
+func nonil(err ...error) error {
+	for _, e := range err {
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// +build linux
+
+package sshos
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// ErrBadPermissions is returned when a file is rejected by the StrictModes
+// checks of a Loader.
+var ErrBadPermissions = errors.New("bad owner or permissions")
+
+// checkFile reports an error if the file, or any of its parent directories
+// up to the home directory of the user, belongs to anyone but the user or
+// root, or has any of the perm bits set. Directories may not be writable
+// by group or others. Missing files pass the check.
+func (l *Loader) checkFile(path string, perm os.FileMode) error {
+	if !l.StrictModes {
+		return nil
+	}
+
+	u, err := l.user()
+	if err != nil {
+		return err
+	}
+
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid uid of %q user: %w", u.Username, err)
+	}
+
+	real, err := filepath.EvalSymlinks(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if real, err = filepath.Abs(real); err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(real)
+	if err != nil {
+		return err
+	}
+
+	if !fi.Mode().IsRegular() || !safe(fi, uint32(uid), perm) {
+		return fmt.Errorf("%w on %q", ErrBadPermissions, path)
+	}
+
+	home := filepath.Clean(u.HomeDir)
+
+	for dir := filepath.Dir(real); ; dir = filepath.Dir(dir) {
+		fi, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+
+		if !fi.IsDir() || !safe(fi, uint32(uid), 022) {
+			return fmt.Errorf("%w on %q directory", ErrBadPermissions, dir)
+		}
+
+		if dir == home || dir == filepath.Dir(dir) {
+			return nil
+		}
+	}
+}
+
+func safe(fi os.FileInfo, uid uint32, perm os.FileMode) bool {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+
+	return (st.Uid == uid || st.Uid == 0) && fi.Mode().Perm()&perm == 0
+}
@@ -0,0 +1,127 @@
+package sshos
+
+import (
+	"fmt"
+	"os/user"
+	"path/filepath"
+	"sync"
+
+	"github.com/glaucusio/ssh"
+)
+
+// NewUserLoader returns a loader for the files of the given local user,
+// which may also be given by uid, with StrictModes enabled. The project
+// config is disabled, as the working directory belongs to the caller.
+func NewUserLoader(username string) (*Loader, error) {
+	u, err := lookupUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	l := NewLoader(filepath.Join(u.HomeDir, ".ssh"))
+	l.User = u
+	l.StrictModes = true
+	l.Overlay = "none"
+
+	return l, nil
+}
+
+// Users builds clients for local users with NewUserLoader and caches them
+// per user, for services making connections on behalf of many users.
+type Users struct {
+	// Setup, when not nil, customizes the loader of a user before
+	// the client is built.
+	Setup func(*Loader)
+
+	mu      sync.Mutex
+	clients map[string]*ssh.Client // keyed by uid
+}
+
+// NewClient returns the client of the given user, building it on first use.
+func (u *Users) NewClient(username string) (*ssh.Client, error) {
+	usr, err := lookupUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	u.mu.Lock()
+	c, ok := u.clients[usr.Uid]
+	u.mu.Unlock()
+
+	if ok {
+		return c, nil
+	}
+
+	l, err := NewUserLoader(usr.Uid)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Setup != nil {
+		u.Setup(l)
+	}
+
+	if c, err = l.NewClient(); err != nil {
+		return nil, fmt.Errorf("failed to load config of %q user: %w", usr.Username, err)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if cached, ok := u.clients[usr.Uid]; ok {
+		return cached, nil
+	}
+
+	if u.clients == nil {
+		u.clients = make(map[string]*ssh.Client)
+	}
+
+	u.clients[usr.Uid] = c
+
+	return c, nil
+}
+
+// Invalidate drops the cached client of the given user, so that its files
+// are read again on next use.
+func (u *Users) Invalidate(username string) {
+	usr, err := lookupUser(username)
+	if err != nil {
+		return
+	}
+
+	u.mu.Lock()
+	delete(u.clients, usr.Uid)
+	u.mu.Unlock()
+}
+
+// Reset drops all the cached clients.
+func (u *Users) Reset() {
+	u.mu.Lock()
+	u.clients = nil
+	u.mu.Unlock()
+}
+
+// lookupUser looks up the user by name, or by uid if there is no such name,
+// or returns the current user if the name is empty.
+func lookupUser(username string) (*user.User, error) {
+	if username == "" {
+		u, err := user.Current()
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup user: %w", err)
+		}
+		return u, nil
+	}
+
+	u, err := user.Lookup(username)
+	if _, ok := err.(user.UnknownUserError); ok {
+		if uid, e := user.LookupId(username); e == nil {
+			u, err = uid, nil
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup user: %w", err)
+	}
+
+	return u, nil
+}
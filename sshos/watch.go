@@ -0,0 +1,280 @@
+package sshos
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/glaucusio/ssh"
+	"github.com/glaucusio/ssh/sshfile"
+)
+
+// Reload describes a rebuild of the configuration of a watching client.
+type Reload struct {
+	Files []string // files whose changes triggered the reload
+	Err   error    // reason of the failure, the last good configuration is kept
+}
+
+const (
+	defaultWatchInterval = 2 * time.Second
+	watchDelay           = 100 * time.Millisecond // time to wait for more changes
+)
+
+// Watch returns a client like NewClient does, except that its configuration
+// is rebuilt whenever the user, project or system config, any of the files
+// they include, the known hosts files or the identity files, including the
+// ones named in the configs, change, until the context is done.
+//
+// The changes are detected with inotify where available, and by polling the
+// files every WatchInterval in any case. The result of every reload is sent
+// to the events channel, unless it is nil. A failed reload does not affect
+// the client, which keeps using the last good configuration.
+func (l *Loader) Watch(ctx context.Context, events chan<- Reload) (*ssh.Client, error) {
+	w := &watcher{
+		loader: l.copy(),
+		events: events,
+	}
+
+	parser := *w.loader.parser()
+	parser.Include = func(pattern string) {
+		w.patterns = append(w.patterns, pattern)
+	}
+	w.loader.Parser = &parser
+
+	cb, err := w.build()
+	if err != nil {
+		return nil, err
+	}
+
+	w.cb.Store(cb)
+	w.files = w.snapshot()
+
+	go w.run(ctx)
+
+	c := &ssh.Client{
+		ConfigCallback: func(ctx context.Context, network, address string) (*ssh.Config, error) {
+			return w.cb.Load().(ssh.ConfigCallback)(ctx, network, address)
+		},
+	}
+
+	return c, nil
+}
+
+// notifier signals changes of files in the watched directories.
+type notifier interface {
+	Add(dir string) error
+	C() <-chan struct{}
+	Close() error
+}
+
+type watcher struct {
+	loader   *Loader
+	events   chan<- Reload
+	cb       atomic.Value    // ssh.ConfigCallback
+	patterns []string        // include patterns of the last build
+	configs  sshfile.Configs // configs of the last build
+	files    snapshot
+}
+
+func (w *watcher) run(ctx context.Context) {
+	var notify <-chan struct{}
+
+	n, err := newNotifier()
+	if err == nil {
+		defer n.Close()
+		w.watch(n)
+		notify = n.C()
+	}
+
+	ticker := time.NewTicker(w.loader.watchInterval())
+	defer ticker.Stop()
+
+	delay := time.NewTimer(watchDelay)
+	delay.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-notify:
+			delay.Reset(watchDelay)
+			continue
+		case <-delay.C:
+		case <-ticker.C:
+		}
+
+		files := w.snapshot()
+
+		changed := w.files.diff(files)
+		if len(changed) == 0 {
+			continue
+		}
+
+		w.files = files
+
+		r := w.reload(changed)
+
+		if r.Err == nil {
+			// The new configuration may include different files.
+			w.files = w.snapshot()
+
+			if notify != nil {
+				w.watch(n)
+			}
+		}
+
+		if w.events != nil {
+			select {
+			case w.events <- r:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func (w *watcher) watch(n notifier) {
+	for _, dir := range w.dirs() {
+		_ = n.Add(dir) // the directory may not exist yet, polling covers it
+	}
+}
+
+func (w *watcher) reload(changed []string) Reload {
+	patterns := w.patterns
+	w.patterns = nil
+
+	cb, err := w.build()
+	if err != nil {
+		w.patterns = patterns
+		return Reload{Files: changed, Err: err}
+	}
+
+	w.cb.Store(cb)
+
+	return Reload{Files: changed}
+}
+
+// build builds the callback, failing also if the config that applies
+// to every host does not build, so that errors in the identity or known
+// hosts files do not replace the last good configuration.
+func (w *watcher) build() (ssh.ConfigCallback, error) {
+	cfgfile, err := w.loader.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfgfile.Check(); err != nil {
+		return nil, err
+	}
+
+	cb, err := w.loader.configCallback(cfgfile)
+	if err != nil {
+		return nil, err
+	}
+
+	w.configs = cfgfile
+
+	return cb, nil
+}
+
+// paths returns the files the configuration is built from, including
+// the ones matching the include patterns.
+func (w *watcher) paths() []string {
+	l := w.loader
+
+	paths := []string{
+		l.userConfig(),
+		l.systemConfig(),
+		l.userKnownHosts(),
+		l.systemKnownHosts(),
+	}
+
+	paths = append(paths, l.identity()...)
+	paths = append(paths, w.configs.Files()...)
+
+	if overlay := l.overlay(); overlay != "" {
+		paths = append(paths, overlay)
+	}
+
+	for _, pattern := range w.patterns {
+		files, _ := filepath.Glob(pattern)
+		paths = append(paths, files...)
+	}
+
+	return paths
+}
+
+// dirs returns directories holding the watched files, which are watched
+// instead of the files in order to detect files being replaced or created.
+func (w *watcher) dirs() []string {
+	seen := make(map[string]struct{})
+
+	for _, path := range w.paths() {
+		seen[filepath.Dir(path)] = struct{}{}
+	}
+
+	for _, pattern := range w.patterns {
+		seen[filepath.Dir(pattern)] = struct{}{}
+	}
+
+	dirs := make([]string, 0, len(seen))
+	for dir := range seen {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	return dirs
+}
+
+func (w *watcher) snapshot() snapshot {
+	s := make(snapshot)
+
+	for _, path := range w.paths() {
+		if fi, err := os.Stat(path); err == nil {
+			s[path] = fileState{mod: fi.ModTime(), size: fi.Size(), mode: fi.Mode()}
+		} else {
+			s[path] = fileState{}
+		}
+	}
+
+	return s
+}
+
+type fileState struct {
+	mod  time.Time
+	size int64
+	mode os.FileMode
+}
+
+type snapshot map[string]fileState
+
+// diff returns sorted paths of the files that differ between the snapshots.
+func (s snapshot) diff(t snapshot) []string {
+	var changed []string
+
+	for path, st := range t {
+		if prev, ok := s[path]; !ok || !prev.mod.Equal(st.mod) || prev.size != st.size || prev.mode != st.mode {
+			changed = append(changed, path)
+		}
+	}
+
+	for path := range s {
+		if _, ok := t[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+
+	sort.Strings(changed)
+
+	return changed
+}
+
+func (l *Loader) watchInterval() time.Duration {
+	if l.WatchInterval != 0 {
+		return l.WatchInterval
+	}
+	return defaultWatchInterval
+}
@@ -0,0 +1,68 @@
+// +build linux
+
+package sshos
+
+import (
+	"os"
+	"syscall"
+)
+
+// inotify is a notifier backed by the inotify API.
+type inotify struct {
+	fd int
+	f  *os.File
+	c  chan struct{}
+}
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+func newNotifier() (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	// The descriptor is non-blocking, so reads go through the runtime
+	// poller and are interrupted by Close. It must not be taken with
+	// Fd, which would put it back into blocking mode.
+	n := &inotify{
+		fd: fd,
+		f:  os.NewFile(uintptr(fd), "inotify"),
+		c:  make(chan struct{}, 1),
+	}
+
+	go n.read()
+
+	return n, nil
+}
+
+func (n *inotify) Add(dir string) error {
+	if _, err := syscall.InotifyAddWatch(n.fd, dir, inotifyMask); err != nil {
+		return os.NewSyscallError("inotify_add_watch", err)
+	}
+	return nil
+}
+
+func (n *inotify) C() <-chan struct{} {
+	return n.c
+}
+
+func (n *inotify) Close() error {
+	return n.f.Close()
+}
+
+func (n *inotify) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+
+	for {
+		if _, err := n.f.Read(buf); err != nil {
+			return
+		}
+
+		select {
+		case n.c <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,9 @@
+// +build !linux
+
+package sshos
+
+import "errors"
+
+func newNotifier() (notifier, error) {
+	return nil, errors.New("file notifications are not supported")
+}
@@ -0,0 +1,184 @@
+package sshos_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/glaucusio/ssh/sshfile"
+	"github.com/glaucusio/ssh/sshos"
+)
+
+func TestLoaderWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshos")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string) {
+		t.Helper()
+
+		path := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("MkdirAll()=%s", err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile()=%s", err)
+		}
+	}
+
+	write("config", "Include config.d/*\nUserKnownHostsFile "+filepath.Join(dir, "hosts", "known_hosts")+
+		"\n\nHost web\n\tUser admin\n\tStrictHostKeyChecking no\n\tIdentityFile "+filepath.Join(dir, "keys", "id_web")+"\n")
+
+	l := &sshos.Loader{
+		Dir:              dir,
+		UserConfig:       filepath.Join(dir, "config"),
+		UserKnownHosts:   filepath.Join(dir, "known_hosts"),
+		SystemConfig:     filepath.Join(dir, "ssh_config"),
+		SystemKnownHosts: filepath.Join(dir, "ssh_known_hosts"),
+		Identity:         []string{filepath.Join(dir, "id_ed25519"), filepath.Join(dir, "id_rsa")},
+		Parser:           &sshfile.Parser{},
+		Overlay:          "none",
+		WatchInterval:    50 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan sshos.Reload, 1)
+
+	c, err := l.Watch(ctx, events)
+	if err != nil {
+		t.Fatalf("Watch()=%s", err)
+	}
+
+	user := func() string {
+		t.Helper()
+
+		cfg, err := c.Config(ctx, "tcp", "web:22")
+		if err != nil {
+			t.Fatalf("Config()=%s", err)
+		}
+
+		return cfg.User
+	}
+
+	reload := func() sshos.Reload {
+		t.Helper()
+
+		select {
+		case r := <-events:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for reload")
+			return sshos.Reload{}
+		}
+	}
+
+	if u := user(); u != "admin" {
+		t.Fatalf("got %q, want %q", u, "admin")
+	}
+
+	write("config.d/web", "Host web\n\tUser deploy\n")
+
+	if r := reload(); r.Err != nil || len(r.Files) != 1 || r.Files[0] != filepath.Join(dir, "config.d", "web") {
+		t.Fatalf("unexpected reload: %+v", r)
+	}
+
+	if u := user(); u != "deploy" {
+		t.Fatalf("got %q, want %q", u, "deploy")
+	}
+
+	write("config.d/web", "Host web\n\tUser deploy\n\tPort none\n")
+
+	if r := reload(); r.Err == nil {
+		t.Fatalf("unexpected reload: %+v", r)
+	}
+
+	if u := user(); u != "deploy" {
+		t.Fatalf("got %q, want %q", u, "deploy")
+	}
+
+	write("config.d/web", "Host web\n\tUser deploy\n\tStrictHostKeyChecking no\n")
+
+	if r := reload(); r.Err != nil {
+		t.Fatalf("unexpected reload: %+v", r)
+	}
+
+	for _, name := range []string{"keys/id_web", "hosts/known_hosts"} {
+		write(name, "")
+
+		if r := reload(); r.Err != nil || len(r.Files) != 1 || r.Files[0] != filepath.Join(dir, name) {
+			t.Fatalf("unexpected reload: %+v", r)
+		}
+	}
+
+	write("hosts/known_hosts", "web ssh-ed25519 garbage\n")
+	write("config.d/web", "Host web\n\tUser root\n\tStrictHostKeyChecking no\n")
+
+	if r := reload(); r.Err == nil {
+		t.Fatalf("unexpected reload: %+v", r)
+	}
+
+	if u := user(); u != "deploy" {
+		t.Fatalf("got %q, want %q", u, "deploy")
+	}
+}
+
+func TestLoaderWatchCancel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshos")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := &sshos.Loader{
+		Dir:           dir,
+		SystemConfig:  filepath.Join(dir, "ssh_config"),
+		Parser:        &sshfile.Parser{},
+		Overlay:       "none",
+		WatchInterval: 50 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	if _, err := l.Watch(ctx, nil); err != nil {
+		cancel()
+		t.Fatalf("Watch()=%s", err)
+	}
+
+	// Make the reader go through a notification and wait for the next one.
+	time.Sleep(50 * time.Millisecond)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "config"), nil, 0644); err != nil {
+		cancel()
+		t.Fatalf("WriteFile()=%s", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	cancel()
+
+	running := func() bool {
+		buf := make([]byte, 1<<20)
+		buf = buf[:runtime.Stack(buf, true)]
+
+		return bytes.Contains(buf, []byte("sshos.(*inotify).read")) ||
+			bytes.Contains(buf, []byte("sshos.(*watcher).run"))
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); running(); {
+		if time.Now().After(deadline) {
+			t.Fatal("watcher goroutines still running after the context is done")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
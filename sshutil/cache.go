@@ -0,0 +1,149 @@
+package sshutil
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/glaucusio/ssh"
+	"github.com/glaucusio/xerrors"
+)
+
+// Cache memoizes configs resolved by a callback per network and address.
+//
+// Concurrent lookups of the same address are collapsed into a single call
+// of the callback. Failures other than ssh.ErrConfigNotFound are not cached.
+type Cache struct {
+	ConfigCallback ssh.ConfigCallback
+
+	TTL         time.Duration // how long configs are kept; forever if 0
+	NegativeTTL time.Duration // how long ssh.ErrConfigNotFound is kept; not kept if 0
+
+	mu      sync.Mutex
+	entries map[cacheKey]*cacheEntry
+}
+
+type cacheKey struct {
+	network, address string
+}
+
+type cacheEntry struct {
+	done    chan struct{}
+	cfg     *ssh.Config
+	err     error
+	expires time.Time // zero if the entry never expires
+}
+
+// NewCache returns a cache of configs resolved by cb, which keeps
+// both configs and ssh.ErrConfigNotFound results for the given duration.
+// If ttl is 0, configs are kept until invalidated and missing configs
+// are not kept at all.
+func NewCache(cb ssh.ConfigCallback, ttl time.Duration) *Cache {
+	return &Cache{
+		ConfigCallback: cb,
+		TTL:            ttl,
+		NegativeTTL:    ttl,
+	}
+}
+
+// Callback returns a callback that resolves configs from the cache.
+//
+// Each call returns a copy of the cached config, so callers may append
+// auth methods to it without affecting other callers.
+func (c *Cache) Callback() ssh.ConfigCallback {
+	return func(ctx context.Context, network, address string) (*ssh.Config, error) {
+		for {
+			e, leader := c.entry(cacheKey{network, address})
+
+			if leader {
+				c.resolve(ctx, cacheKey{network, address}, e)
+			} else {
+				select {
+				case <-e.done:
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+
+			// The leader's context may have expired while ours is still
+			// valid, in which case we retry the lookup ourselves.
+			if !leader && isContextErr(e.err) && ctx.Err() == nil {
+				continue
+			}
+
+			if e.err != nil {
+				return nil, e.err
+			}
+
+			return e.cfg.Clone(), nil
+		}
+	}
+}
+
+// Invalidate removes config of the address from the cache.
+func (c *Cache) Invalidate(network, address string) {
+	c.mu.Lock()
+	delete(c.entries, cacheKey{network, address})
+	c.mu.Unlock()
+}
+
+// Reset removes all configs from the cache.
+func (c *Cache) Reset() {
+	c.mu.Lock()
+	c.entries = nil
+	c.mu.Unlock()
+}
+
+// entry returns an entry for the key, either cached or in progress, or a
+// new one, in which case the caller is responsible for resolving it.
+func (c *Cache) entry(k cacheKey) (e *cacheEntry, leader bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[k]; ok && (e.expires.IsZero() || time.Now().Before(e.expires)) {
+		return e, false
+	}
+
+	if c.entries == nil {
+		c.entries = make(map[cacheKey]*cacheEntry)
+	}
+
+	e = &cacheEntry{done: make(chan struct{})}
+	c.entries[k] = e
+
+	return e, true
+}
+
+func (c *Cache) resolve(ctx context.Context, k cacheKey, e *cacheEntry) {
+	defer close(e.done)
+
+	// Configs are shared by all destinations of the address, so they must
+	// not depend on the user given in the destination.
+	e.cfg, e.err = c.ConfigCallback(ssh.WithDestination(ctx, nil), k.network, k.address)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var ttl time.Duration
+
+	switch {
+	case e.err == nil:
+		ttl = c.TTL
+	case xerrors.Is(e.err, ssh.ErrConfigNotFound) && c.NegativeTTL > 0:
+		ttl = c.NegativeTTL
+	default:
+		// Drop the entry unless it was invalidated in the meantime.
+		if c.entries[k] == e {
+			delete(c.entries, k)
+		}
+		return
+	}
+
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+}
+
+func isContextErr(err error) bool {
+	return xerrors.Is(err, context.Canceled) || xerrors.Is(err, context.DeadlineExceeded)
+}
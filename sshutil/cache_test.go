@@ -0,0 +1,143 @@
+package sshutil_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/glaucusio/ssh"
+	"github.com/glaucusio/ssh/sshutil"
+	"github.com/glaucusio/xerrors"
+)
+
+type counter struct {
+	calls   int32
+	release chan struct{}
+	err     error
+}
+
+func (c *counter) callback(ctx context.Context, network, address string) (*ssh.Config, error) {
+	atomic.AddInt32(&c.calls, 1)
+
+	if c.release != nil {
+		<-c.release
+	}
+
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	return &ssh.Config{Network: network, Address: address}, nil
+}
+
+func (c *counter) count() int {
+	return int(atomic.LoadInt32(&c.calls))
+}
+
+func TestCache(t *testing.T) {
+	c := &counter{}
+	cache := sshutil.NewCache(c.callback, time.Hour)
+	cb := cache.Callback()
+
+	for i := 0; i < 3; i++ {
+		cfg, err := cb(context.Background(), "tcp", "web:22")
+		if err != nil {
+			t.Fatalf("Callback()=%s", err)
+		}
+
+		if cfg.Address != "web:22" {
+			t.Fatalf("got %q, want %q", cfg.Address, "web:22")
+		}
+
+		cfg.Address = "modified"
+	}
+
+	if _, err := cb(context.Background(), "tcp", "db:22"); err != nil {
+		t.Fatalf("Callback()=%s", err)
+	}
+
+	if n := c.count(); n != 2 {
+		t.Fatalf("got %d calls, want 2", n)
+	}
+
+	cache.Invalidate("tcp", "web:22")
+
+	if _, err := cb(context.Background(), "tcp", "web:22"); err != nil {
+		t.Fatalf("Callback()=%s", err)
+	}
+
+	if n := c.count(); n != 3 {
+		t.Fatalf("got %d calls, want 3", n)
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	c := &counter{err: ssh.ErrConfigNotFound}
+	cache := sshutil.NewCache(c.callback, 50*time.Millisecond)
+	cb := cache.Callback()
+
+	for i := 0; i < 2; i++ {
+		if _, err := cb(context.Background(), "tcp", "web:22"); !xerrors.Is(err, ssh.ErrConfigNotFound) {
+			t.Fatalf("got %v, want %v", err, ssh.ErrConfigNotFound)
+		}
+	}
+
+	if n := c.count(); n != 1 {
+		t.Fatalf("got %d calls, want 1", n)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err := cb(context.Background(), "tcp", "web:22"); !xerrors.Is(err, ssh.ErrConfigNotFound) {
+		t.Fatalf("got %v, want %v", err, ssh.ErrConfigNotFound)
+	}
+
+	if n := c.count(); n != 2 {
+		t.Fatalf("got %d calls, want 2", n)
+	}
+}
+
+func TestCacheErrors(t *testing.T) {
+	c := &counter{err: errors.New("permission denied")}
+	cb := sshutil.NewCache(c.callback, time.Hour).Callback()
+
+	for i := 0; i < 2; i++ {
+		if _, err := cb(context.Background(), "tcp", "web:22"); err != c.err {
+			t.Fatalf("got %v, want %v", err, c.err)
+		}
+	}
+
+	if n := c.count(); n != 2 {
+		t.Fatalf("got %d calls, want 2", n)
+	}
+}
+
+func TestCacheSingleflight(t *testing.T) {
+	c := &counter{release: make(chan struct{})}
+	cb := sshutil.NewCache(c.callback, time.Hour).Callback()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if _, err := cb(context.Background(), "tcp", "web:22"); err != nil {
+				t.Errorf("Callback()=%s", err)
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(c.release)
+	wg.Wait()
+
+	if n := c.count(); n != 1 {
+		t.Fatalf("got %d calls, want 1", n)
+	}
+}
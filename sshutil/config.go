@@ -8,19 +8,58 @@ import (
 	"github.com/glaucusio/xerrors"
 )
 
+// Callback returns a callback that tries the callbacks in order and returns
+// the first config found. If none is found, or a callback fails with an
+// error other than ssh.ErrConfigNotFound, it returns ssh.MultiError with
+// errors of all the callbacks, each annotated with the name of its source,
+// if it was given with NamedCallback, or its position otherwise. The
+// callbacks after such a failure are still called to collect their errors,
+// but the configs they find are not used, as the failed source might have
+// had the config.
 func Callback(callbacks ...ssh.ConfigCallback) ssh.ConfigCallback {
 	return func(ctx context.Context, network, address string) (*ssh.Config, error) {
-		for _, cb := range callbacks {
+		var (
+			errs   ssh.MultiError
+			failed bool
+		)
+
+		for i, cb := range callbacks {
 			cfg, err := cb(ctx, network, address)
 			if err == nil {
-				return cfg, nil
-			}
-			if xerrors.Is(err, ssh.ErrConfigNotFound) {
+				if !failed {
+					return cfg, nil
+				}
 				continue
 			}
-			return nil, err
+
+			var ce *ssh.ConfigError
+			if !xerrors.As(err, &ce) || ce.Source == "" {
+				err = &ssh.ConfigError{Source: fmt.Sprintf("config source #%d", i+1), Err: err}
+			}
+
+			errs = append(errs, err)
+
+			if !xerrors.Is(err, ssh.ErrConfigNotFound) {
+				failed = true
+			}
+		}
+
+		if len(errs) == 0 {
+			return nil, ssh.ErrConfigNotFound
 		}
-		return nil, ssh.ErrConfigNotFound
+
+		return nil, errs
+	}
+}
+
+// NamedCallback annotates errors returned by cb with the name of its source.
+func NamedCallback(name string, cb ssh.ConfigCallback) ssh.ConfigCallback {
+	return func(ctx context.Context, network, address string) (*ssh.Config, error) {
+		cfg, err := cb(ctx, network, address)
+		if err != nil {
+			return nil, &ssh.ConfigError{Source: name, Err: err}
+		}
+		return cfg, nil
 	}
 }
 
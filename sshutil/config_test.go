@@ -0,0 +1,74 @@
+package sshutil_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/glaucusio/ssh"
+	"github.com/glaucusio/ssh/sshutil"
+	"github.com/glaucusio/xerrors"
+)
+
+func notFound(context.Context, string, string) (*ssh.Config, error) {
+	return nil, ssh.ErrConfigNotFound
+}
+
+func TestCallbackErrors(t *testing.T) {
+	errDenied := errors.New("permission denied")
+
+	failing := func(context.Context, string, string) (*ssh.Config, error) {
+		return nil, &ssh.ConfigError{File: "/etc/ssh/ssh_config", Line: 3, Keyword: "Port", Err: errDenied}
+	}
+
+	_, err := sshutil.Callback(
+		sshutil.NamedCallback("user config", notFound),
+		notFound,
+	)(context.Background(), "tcp", "web:22")
+
+	if !xerrors.Is(err, ssh.ErrConfigNotFound) {
+		t.Fatalf("got %v, want %v", err, ssh.ErrConfigNotFound)
+	}
+
+	want := "2 config sources failed:\n\tuser config: config not found\n\tconfig source #2: config not found"
+
+	if err.Error() != want {
+		t.Fatalf("got %q, want %q", err, want)
+	}
+
+	_, err = sshutil.Callback(
+		notFound,
+		sshutil.NamedCallback("system config", failing),
+		echo,
+	)(context.Background(), "tcp", "web:22")
+
+	if xerrors.Is(err, ssh.ErrConfigNotFound) || !xerrors.Is(err, errDenied) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var cerr *ssh.ConfigError
+
+	if !xerrors.As(err, &cerr) || cerr.Source != "config source #1" {
+		t.Fatalf("unexpected error: %#v", err)
+	}
+
+	want = "2 config sources failed:\n\tconfig source #1: config not found\n\tsystem config: /etc/ssh/ssh_config:3: Port: permission denied"
+
+	if err.Error() != want {
+		t.Fatalf("got %q, want %q", err, want)
+	}
+
+	// Errors of the callbacks after the failed one are reported too.
+	_, err = sshutil.Callback(
+		sshutil.NamedCallback("system config", failing),
+		echo,
+		sshutil.NamedCallback("project config", failing),
+	)(context.Background(), "tcp", "web:22")
+
+	want = "2 config sources failed:\n\tsystem config: /etc/ssh/ssh_config:3: Port: permission denied" +
+		"\n\tproject config: /etc/ssh/ssh_config:3: Port: permission denied"
+
+	if err == nil || err.Error() != want {
+		t.Fatalf("got %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,223 @@
+package sshutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/glaucusio/ssh"
+	"github.com/glaucusio/xerrors"
+)
+
+// ErrHostNotAllowed is returned by AllowCallback and DenyCallback
+// for the hosts that are not allowed.
+var ErrHostNotAllowed = errors.New("host not allowed")
+
+// AliasCallback replaces the host of the address with the one it is
+// an alias for, if any, before passing the address to cb.
+func AliasCallback(cb ssh.ConfigCallback, aliases map[string]string) ssh.ConfigCallback {
+	return HostCallback(cb, func(host string) string {
+		if alias, ok := aliases[host]; ok {
+			return alias
+		}
+		return host
+	})
+}
+
+// RewriteCallback replaces matches of the regexp in the host of the address
+// with the replacement, as regexp.ReplaceAllString does, before passing the
+// address to cb.
+func RewriteCallback(cb ssh.ConfigCallback, re *regexp.Regexp, repl string) ssh.ConfigCallback {
+	return HostCallback(cb, func(host string) string {
+		return re.ReplaceAllString(host, repl)
+	})
+}
+
+// HostCallback replaces the host of the address with the result of fn,
+// keeping the rest of the address intact, before passing it to cb.
+func HostCallback(cb ssh.ConfigCallback, fn func(host string) string) ssh.ConfigCallback {
+	return func(ctx context.Context, network, address string) (*ssh.Config, error) {
+		d, err := ssh.ParseDestination(address)
+		if err != nil {
+			return nil, err
+		}
+
+		if host := fn(d.Host); host != d.Host {
+			d.Host = host
+			address = destination(d)
+		}
+
+		return cb(ctx, network, address)
+	}
+}
+
+// DefaultsCallback sets the user and the port of the configs returned
+// by cb, unless they are already set. Zero values are ignored.
+func DefaultsCallback(cb ssh.ConfigCallback, user string, port int) ssh.ConfigCallback {
+	return PatchCallback(cb, func(_ context.Context, cfg *ssh.Config) error {
+		if cfg.User == "" {
+			cfg.User = user
+		}
+
+		if port != 0 && cfg.Address != "" {
+			if _, _, err := net.SplitHostPort(cfg.Address); err != nil {
+				cfg.Address = net.JoinHostPort(cfg.Address, strconv.Itoa(port))
+			}
+		}
+
+		return nil
+	})
+}
+
+// OverrideCallback applies the patch to the configs of the hosts that match
+// the pattern, given in the syntax accepted by path.Match.
+func OverrideCallback(cb ssh.ConfigCallback, pattern string, patch func(context.Context, *ssh.Config) error) ssh.ConfigCallback {
+	return func(ctx context.Context, network, address string) (*ssh.Config, error) {
+		cfg, err := cb(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		ok, err := matchHost(address, pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			if err := patch(ctx, cfg); err != nil {
+				return nil, fmt.Errorf("failed to patch config: %w", err)
+			}
+		}
+
+		return cfg, nil
+	}
+}
+
+// AllowCallback fails with ErrHostNotAllowed for the hosts that do not match
+// any of the patterns, given in the syntax accepted by path.Match.
+func AllowCallback(cb ssh.ConfigCallback, patterns ...string) ssh.ConfigCallback {
+	return filterCallback(cb, patterns, true)
+}
+
+// DenyCallback fails with ErrHostNotAllowed for the hosts that match any
+// of the patterns, given in the syntax accepted by path.Match.
+func DenyCallback(cb ssh.ConfigCallback, patterns ...string) ssh.ConfigCallback {
+	return filterCallback(cb, patterns, false)
+}
+
+func filterCallback(cb ssh.ConfigCallback, patterns []string, allow bool) ssh.ConfigCallback {
+	return func(ctx context.Context, network, address string) (*ssh.Config, error) {
+		ok, err := matchHost(address, patterns...)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok != allow {
+			return nil, fmt.Errorf("%s: %w", address, ErrHostNotAllowed)
+		}
+
+		return cb(ctx, network, address)
+	}
+}
+
+// TimeoutCallback fails with context.DeadlineExceeded if cb does not
+// return within the given duration.
+//
+// The cb is called with a context that expires after the duration and
+// it must honour it, otherwise it keeps running in the background after
+// TimeoutCallback has returned.
+func TimeoutCallback(cb ssh.ConfigCallback, timeout time.Duration) ssh.ConfigCallback {
+	return func(ctx context.Context, network, address string) (*ssh.Config, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		type result struct {
+			cfg *ssh.Config
+			err error
+		}
+
+		ch := make(chan result, 1)
+
+		go func() {
+			cfg, err := cb(ctx, network, address)
+			ch <- result{cfg, err}
+		}()
+
+		select {
+		case r := <-ch:
+			return r.cfg, r.err
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%s: %w", address, ctx.Err())
+		}
+	}
+}
+
+// LogCallback logs every call to cb together with its result and duration,
+// using a function like log.Printf.
+func LogCallback(cb ssh.ConfigCallback, logf func(format string, args ...interface{})) ssh.ConfigCallback {
+	return func(ctx context.Context, network, address string) (*ssh.Config, error) {
+		start := time.Now()
+
+		cfg, err := cb(ctx, network, address)
+
+		if err != nil {
+			logf("ssh: config for %s/%s: error: %s (%s)", network, address, err, time.Since(start))
+		} else {
+			logf("ssh: config for %s/%s: %s@%s/%s (%s)", network, address, cfg.User, cfg.Network, cfg.Address, time.Since(start))
+		}
+
+		return cfg, err
+	}
+}
+
+// FallbackCallback calls cb with the address and, if no config was found,
+// with the alternative addresses returned by fn, in order, until one of
+// them is found.
+func FallbackCallback(cb ssh.ConfigCallback, fn func(address string) []string) ssh.ConfigCallback {
+	return func(ctx context.Context, network, address string) (*ssh.Config, error) {
+		for _, address := range append([]string{address}, fn(address)...) {
+			cfg, err := cb(ctx, network, address)
+			if err == nil {
+				return cfg, nil
+			}
+			if xerrors.Is(err, ssh.ErrConfigNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		return nil, ssh.ErrConfigNotFound
+	}
+}
+
+func matchHost(address string, patterns ...string) (bool, error) {
+	d, err := ssh.ParseDestination(address)
+	if err != nil {
+		return false, err
+	}
+
+	for _, pattern := range patterns {
+		ok, err := path.Match(pattern, d.Host)
+		if err != nil {
+			return false, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// destination formats the destination back as an address, in the plain
+// host[:port] form unless it carries more than that.
+func destination(d *ssh.Destination) string {
+	if d.User == "" && d.Fingerprint == "" && d.Path == "" {
+		return d.Address()
+	}
+	return d.String()
+}
@@ -0,0 +1,171 @@
+package sshutil_test
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glaucusio/ssh"
+	"github.com/glaucusio/ssh/sshutil"
+	"github.com/glaucusio/xerrors"
+)
+
+func echo(_ context.Context, network, address string) (*ssh.Config, error) {
+	if strings.HasPrefix(address, "missing") {
+		return nil, ssh.ErrConfigNotFound
+	}
+	return &ssh.Config{Network: network, Address: address}, nil
+}
+
+func TestMiddleware(t *testing.T) {
+	var logs []string
+
+	logf := func(format string, args ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}
+
+	tests := []struct {
+		name    string
+		cb      ssh.ConfigCallback
+		address string
+		want    string // address of the config or the error
+	}{{
+		"alias",
+		sshutil.AliasCallback(echo, map[string]string{"web": "web.example.com"}),
+		"web:2222",
+		"web.example.com:2222",
+	}, {
+		"alias with user",
+		sshutil.AliasCallback(echo, map[string]string{"web": "web.example.com"}),
+		"deploy@web",
+		"deploy@web.example.com",
+	}, {
+		"rewrite",
+		sshutil.RewriteCallback(echo, regexp.MustCompile(`^(\w+)-prod$`), "$1.prod.example.com"),
+		"db-prod",
+		"db.prod.example.com",
+	}, {
+		"defaults",
+		sshutil.DefaultsCallback(echo, "deploy", 2222),
+		"web",
+		"deploy@web:2222",
+	}, {
+		"defaults with port",
+		sshutil.DefaultsCallback(echo, "", 2222),
+		"web:22",
+		"web:22",
+	}, {
+		"override",
+		sshutil.OverrideCallback(echo, "*.example.com", func(_ context.Context, cfg *ssh.Config) error {
+			cfg.User = "admin"
+			return nil
+		}),
+		"web.example.com",
+		"admin@web.example.com",
+	}, {
+		"override no match",
+		sshutil.OverrideCallback(echo, "*.example.com", func(_ context.Context, cfg *ssh.Config) error {
+			cfg.User = "admin"
+			return nil
+		}),
+		"web.example.org",
+		"web.example.org",
+	}, {
+		"allow",
+		sshutil.AllowCallback(echo, "web-*", "db"),
+		"web-1:22",
+		"web-1:22",
+	}, {
+		"allow denied",
+		sshutil.AllowCallback(echo, "web-*", "db"),
+		"db-1",
+		"db-1: host not allowed",
+	}, {
+		"deny",
+		sshutil.DenyCallback(echo, "prod-*"),
+		"prod-db",
+		"prod-db: host not allowed",
+	}, {
+		"timeout",
+		sshutil.TimeoutCallback(func(ctx context.Context, network, address string) (*ssh.Config, error) {
+			time.Sleep(time.Second)
+			return echo(ctx, network, address)
+		}, 10*time.Millisecond),
+		"web",
+		"web: context deadline exceeded",
+	}, {
+		"fallback",
+		sshutil.FallbackCallback(echo, func(address string) []string {
+			return []string{"missing-too", "web.internal"}
+		}),
+		"missing",
+		"web.internal",
+	}, {
+		"fallback not found",
+		sshutil.FallbackCallback(echo, func(address string) []string {
+			return []string{"missing-too"}
+		}),
+		"missing",
+		ssh.ErrConfigNotFound.Error(),
+	}, {
+		"log",
+		sshutil.LogCallback(echo, logf),
+		"web:22",
+		"web:22",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got string
+
+			cfg, err := test.cb(context.Background(), "tcp", test.address)
+			if err != nil {
+				got = err.Error()
+			} else {
+				got = cfg.Address
+				if cfg.User != "" {
+					got = cfg.User + "@" + got
+				}
+			}
+
+			if got != test.want {
+				t.Fatalf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	if len(logs) != 1 || !strings.HasPrefix(logs[0], "ssh: config for tcp/web:22: @tcp/web:22 (") {
+		t.Fatalf("unexpected logs: %q", logs)
+	}
+
+	_, err := sshutil.DenyCallback(echo, "prod-*")(context.Background(), "tcp", "prod-db")
+	if !xerrors.Is(err, sshutil.ErrHostNotAllowed) {
+		t.Fatalf("got %v, want %v", err, sshutil.ErrHostNotAllowed)
+	}
+}
+
+func TestTimeoutCallbackContext(t *testing.T) {
+	done := make(chan error, 1)
+
+	cb := sshutil.TimeoutCallback(func(ctx context.Context, network, address string) (*ssh.Config, error) {
+		<-ctx.Done()
+		done <- ctx.Err()
+		return nil, ctx.Err()
+	}, 10*time.Millisecond)
+
+	if _, err := cb(context.Background(), "tcp", "web"); !xerrors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("callback did not observe the deadline")
+	}
+}